@@ -0,0 +1,170 @@
+package ecsceed
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/fatih/color"
+)
+
+var alarmPollInterval = 15 * time.Second
+
+type alarmState struct {
+	value     string
+	updatedAt time.Time
+}
+
+// alarmStateClient gets the current states of the alarms by name
+type alarmStateClient interface {
+	AlarmStates(ctx context.Context, names []string) (map[string]alarmState, error)
+}
+
+type cloudWatchAlarms struct {
+	cw *cloudwatch.CloudWatch
+}
+
+func (c *cloudWatchAlarms) AlarmStates(ctx context.Context, names []string) (map[string]alarmState, error) {
+	states := map[string]alarmState{}
+	err := c.cw.DescribeAlarmsPagesWithContext(ctx,
+		&cloudwatch.DescribeAlarmsInput{
+			AlarmNames: aws.StringSlice(names),
+			AlarmTypes: aws.StringSlice([]string{cloudwatch.AlarmTypeMetricAlarm, cloudwatch.AlarmTypeCompositeAlarm}),
+		},
+		func(out *cloudwatch.DescribeAlarmsOutput, lastPage bool) bool {
+			for _, m := range out.MetricAlarms {
+				states[*m.AlarmName] = alarmState{value: *m.StateValue, updatedAt: aws.TimeValue(m.StateUpdatedTimestamp)}
+			}
+			for _, c := range out.CompositeAlarms {
+				states[*c.AlarmName] = alarmState{value: *c.StateValue, updatedAt: aws.TimeValue(c.StateUpdatedTimestamp)}
+			}
+			return true
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+	return states, nil
+}
+
+// serviceAlarms lists the alarms of the services without duplicates
+func (a *App) serviceAlarms(names []string) []string {
+	alarms := []string{}
+	seen := map[string]bool{}
+	for _, name := range names {
+		for _, alarm := range a.def.nameToSrv[name].alarms {
+			if seen[alarm] {
+				continue
+			}
+			seen[alarm] = true
+			alarms = append(alarms, alarm)
+		}
+	}
+	return alarms
+}
+
+// firingAlarms lists the alarms which went into ALARM since startedAt
+func firingAlarms(states map[string]alarmState, startedAt time.Time) []string {
+	firing := []string{}
+	for name, s := range states {
+		if s.value == cloudwatch.StateValueAlarm && !s.updatedAt.Before(startedAt) {
+			firing = append(firing, name)
+		}
+	}
+	sort.Strings(firing)
+	return firing
+}
+
+// watchAlarms polls the alarms until stopped. The returned context is canceled when any alarm goes into ALARM,
+// and stop returns the error of the alarms.
+// Alarms already in ALARM fail it unless force, which ignores them until they change the state again.
+func (a *App) watchAlarms(ctx context.Context, names []string, force bool) (context.Context, func() error, error) {
+	if len(names) == 0 {
+		return ctx, func() error { return nil }, nil
+	}
+
+	startedAt := time.Now()
+	states, err := a.alarmClient.AlarmStates(ctx, names)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to describe alarms: %w", err)
+	}
+	inAlarm := []string{}
+	for _, name := range names {
+		s, ok := states[name]
+		if !ok {
+			return nil, nil, fmt.Errorf("alarm %s is not found", name)
+		}
+		if s.value == cloudwatch.StateValueAlarm {
+			inAlarm = append(inAlarm, name)
+		}
+	}
+	if len(inAlarm) > 0 {
+		if !force {
+			return nil, nil, fmt.Errorf("alarms are already in ALARM: %s. use --force to deploy anyway", strings.Join(inAlarm, ", "))
+		}
+		a.Log(color.YellowString("Ignoring alarms already in ALARM: %s", strings.Join(inAlarm, ", ")))
+	}
+	a.Log("Watching alarms", LogTarget(strings.Join(names, ", ")))
+
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	var alarmErr error
+	go func() {
+		defer close(done)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(alarmPollInterval):
+			}
+
+			states, err := a.alarmClient.AlarmStates(ctx, names)
+			if err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+				a.Log(color.YellowString("failed to describe alarms: %s", err))
+				continue
+			}
+			if firing := firingAlarms(states, startedAt); len(firing) > 0 {
+				alarmErr = fmt.Errorf("alarms went into ALARM: %s", strings.Join(firing, ", "))
+				a.Log(color.RedString("%s", alarmErr))
+				cancel()
+				return
+			}
+		}
+	}()
+
+	stop := func() error {
+		cancel()
+		<-done
+		return alarmErr
+	}
+	return ctx, stop, nil
+}
+
+// bake waits for the longest bake time of the services while the alarms are watched
+func (a *App) bake(ctx context.Context, names []string) error {
+	var d time.Duration
+	for _, name := range names {
+		if t := a.def.nameToSrv[name].bakeTime; t > d {
+			d = t
+		}
+	}
+	if d == 0 {
+		return nil
+	}
+
+	a.Log("Baking for", d)
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(d):
+	}
+	a.Log(LogDone(), "Baked", LogTarget(strings.Join(names, ", ")))
+	return nil
+}
@@ -0,0 +1,123 @@
+package ecsceed
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeAlarmStates struct {
+	mu     sync.Mutex
+	states map[string]alarmState
+}
+
+func (f *fakeAlarmStates) AlarmStates(ctx context.Context, names []string) (map[string]alarmState, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	states := map[string]alarmState{}
+	for _, name := range names {
+		if s, ok := f.states[name]; ok {
+			states[name] = s
+		}
+	}
+	return states, nil
+}
+
+func (f *fakeAlarmStates) set(name string, s alarmState) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.states[name] = s
+}
+
+func setAlarmPollInterval(t *testing.T, d time.Duration) {
+	orig := alarmPollInterval
+	alarmPollInterval = d
+	t.Cleanup(func() { alarmPollInterval = orig })
+}
+
+func TestServiceAlarms(t *testing.T) {
+	app := &App{
+		def: Definition{
+			nameToSrv: map[string]Service{
+				"api":    {alarms: []string{"5xx", "latency"}},
+				"worker": {alarms: []string{"5xx", "queue"}},
+				"admin":  {},
+			},
+		},
+	}
+	assert.Equal(t, []string{"5xx", "latency", "queue"}, app.serviceAlarms([]string{"api", "worker", "admin"}))
+	assert.Empty(t, app.serviceAlarms([]string{"admin"}))
+}
+
+func TestWatchAlarms(t *testing.T) {
+	setAlarmPollInterval(t, 10*time.Millisecond)
+
+	past := time.Now().Add(-time.Hour)
+	fake := &fakeAlarmStates{states: map[string]alarmState{
+		"5xx":   {value: "OK", updatedAt: past},
+		"noisy": {value: "ALARM", updatedAt: past},
+	}}
+	app := &App{alarmClient: fake}
+
+	// alarms already in ALARM before the deploy refuse it
+	_, _, err := app.watchAlarms(context.Background(), []string{"5xx", "noisy"}, false)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "noisy")
+		assert.NotContains(t, err.Error(), "5xx")
+	}
+
+	// and are ignored with force
+	ctx, stop, err := app.watchAlarms(context.Background(), []string{"5xx", "noisy"}, true)
+	assert.NoError(t, err)
+	time.Sleep(50 * time.Millisecond)
+	assert.NoError(t, ctx.Err())
+	assert.NoError(t, stop())
+
+	ctx, stop, err = app.watchAlarms(context.Background(), []string{"5xx", "noisy"}, true)
+	assert.NoError(t, err)
+	fake.set("5xx", alarmState{value: "ALARM", updatedAt: time.Now()})
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second):
+		t.Fatal("watch was not canceled by the alarm")
+	}
+	err = stop()
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "5xx")
+		assert.NotContains(t, err.Error(), "noisy")
+	}
+
+	_, _, err = app.watchAlarms(context.Background(), []string{"missing"}, false)
+	assert.Error(t, err)
+}
+
+func TestBake(t *testing.T) {
+	setAlarmPollInterval(t, 10*time.Millisecond)
+
+	fake := &fakeAlarmStates{states: map[string]alarmState{
+		"5xx": {value: "OK", updatedAt: time.Now().Add(-time.Hour)},
+	}}
+	app := &App{
+		alarmClient: fake,
+		def: Definition{
+			nameToSrv: map[string]Service{
+				"api":    {alarms: []string{"5xx"}, bakeTime: time.Hour},
+				"worker": {},
+			},
+		},
+	}
+
+	assert.NoError(t, app.bake(context.Background(), []string{"worker"}))
+
+	ctx, stop, err := app.watchAlarms(context.Background(), app.serviceAlarms([]string{"api"}), false)
+	assert.NoError(t, err)
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		fake.set("5xx", alarmState{value: "ALARM", updatedAt: time.Now()})
+	}()
+	assert.Error(t, app.bake(ctx, []string{"api"}))
+	assert.Error(t, stop())
+}
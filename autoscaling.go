@@ -0,0 +1,445 @@
+package ecsceed
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/applicationautoscaling"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/fatih/color"
+	"github.com/kylelemons/godebug/diff"
+)
+
+// autoScalingDefinition is the scalable target, policies and scheduled actions of a service in a comparable form
+type autoScalingDefinition struct {
+	Target           *applicationautoscaling.RegisterScalableTargetInput
+	Policies         []*applicationautoscaling.PutScalingPolicyInput
+	ScheduledActions []*applicationautoscaling.PutScheduledActionInput
+}
+
+func autoScalingResourceID(cluster string, fullname string) string {
+	return fmt.Sprintf("service/%s/%s", arnToName(cluster), fullname)
+}
+
+func cooldownSeconds(s string) (*int64, error) {
+	if s == "" {
+		return nil, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cooldown %s: %w", s, err)
+	}
+	return aws.Int64(int64(d.Seconds())), nil
+}
+
+func buildAutoScaling(resourceID string, c *ConfigAutoScaling) (*autoScalingDefinition, error) {
+	if c.MinCapacity == nil || c.MaxCapacity == nil {
+		return nil, fmt.Errorf("autoscaling requires min_capacity and max_capacity")
+	}
+	if *c.MinCapacity < 0 || *c.MinCapacity > *c.MaxCapacity {
+		return nil, fmt.Errorf("invalid autoscaling capacity min:%d max:%d", *c.MinCapacity, *c.MaxCapacity)
+	}
+
+	def := &autoScalingDefinition{
+		Target: &applicationautoscaling.RegisterScalableTargetInput{
+			MinCapacity:       c.MinCapacity,
+			MaxCapacity:       c.MaxCapacity,
+			ResourceId:        aws.String(resourceID),
+			ScalableDimension: aws.String(applicationautoscaling.ScalableDimensionEcsServiceDesiredCount),
+			ServiceNamespace:  aws.String(applicationautoscaling.ServiceNamespaceEcs),
+		},
+		Policies:         []*applicationautoscaling.PutScalingPolicyInput{},
+		ScheduledActions: []*applicationautoscaling.PutScheduledActionInput{},
+	}
+
+	policyNames := map[string]bool{}
+	addPolicy := func(name string, p *applicationautoscaling.PutScalingPolicyInput) error {
+		if name == "" {
+			return fmt.Errorf("autoscaling policy requires name")
+		}
+		if policyNames[name] {
+			return fmt.Errorf("autoscaling policy %s is duplicated", name)
+		}
+		policyNames[name] = true
+		p.PolicyName = aws.String(name)
+		p.ResourceId = aws.String(resourceID)
+		p.ScalableDimension = aws.String(applicationautoscaling.ScalableDimensionEcsServiceDesiredCount)
+		p.ServiceNamespace = aws.String(applicationautoscaling.ServiceNamespaceEcs)
+		def.Policies = append(def.Policies, p)
+		return nil
+	}
+
+	for _, tt := range c.TargetTracking {
+		if tt.PredefinedMetric == "" {
+			return nil, fmt.Errorf("target tracking policy %s requires predefined_metric", tt.Name)
+		}
+		if tt.TargetValue <= 0 {
+			return nil, fmt.Errorf("target tracking policy %s requires positive target_value", tt.Name)
+		}
+		scaleIn, err := cooldownSeconds(tt.ScaleInCooldown)
+		if err != nil {
+			return nil, err
+		}
+		scaleOut, err := cooldownSeconds(tt.ScaleOutCooldown)
+		if err != nil {
+			return nil, err
+		}
+
+		metric := &applicationautoscaling.PredefinedMetricSpecification{
+			PredefinedMetricType: aws.String(tt.PredefinedMetric),
+		}
+		if tt.ResourceLabel != "" {
+			metric.ResourceLabel = aws.String(tt.ResourceLabel)
+		}
+		conf := &applicationautoscaling.TargetTrackingScalingPolicyConfiguration{
+			PredefinedMetricSpecification: metric,
+			TargetValue:                   aws.Float64(tt.TargetValue),
+			ScaleInCooldown:               scaleIn,
+			ScaleOutCooldown:              scaleOut,
+		}
+		if tt.DisableScaleIn {
+			conf.DisableScaleIn = aws.Bool(true)
+		}
+		if err := addPolicy(tt.Name, &applicationautoscaling.PutScalingPolicyInput{
+			PolicyType:                               aws.String(applicationautoscaling.PolicyTypeTargetTrackingScaling),
+			TargetTrackingScalingPolicyConfiguration: conf,
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, ss := range c.StepScaling {
+		if ss.AdjustmentType == "" {
+			return nil, fmt.Errorf("step scaling policy %s requires adjustment_type", ss.Name)
+		}
+		if len(ss.Steps) == 0 {
+			return nil, fmt.Errorf("step scaling policy %s requires steps", ss.Name)
+		}
+		cooldown, err := cooldownSeconds(ss.Cooldown)
+		if err != nil {
+			return nil, err
+		}
+
+		steps := []*applicationautoscaling.StepAdjustment{}
+		for _, st := range ss.Steps {
+			steps = append(steps, &applicationautoscaling.StepAdjustment{
+				MetricIntervalLowerBound: st.LowerBound,
+				MetricIntervalUpperBound: st.UpperBound,
+				ScalingAdjustment:        aws.Int64(st.Adjustment),
+			})
+		}
+		conf := &applicationautoscaling.StepScalingPolicyConfiguration{
+			AdjustmentType:         aws.String(ss.AdjustmentType),
+			Cooldown:               cooldown,
+			MinAdjustmentMagnitude: ss.MinAdjustmentMagnitude,
+			StepAdjustments:        steps,
+		}
+		if ss.MetricAggregationType != "" {
+			conf.MetricAggregationType = aws.String(ss.MetricAggregationType)
+		}
+		if err := addPolicy(ss.Name, &applicationautoscaling.PutScalingPolicyInput{
+			PolicyType:                     aws.String(applicationautoscaling.PolicyTypeStepScaling),
+			StepScalingPolicyConfiguration: conf,
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	actionNames := map[string]bool{}
+	for _, sa := range c.ScheduledActions {
+		if sa.Name == "" || sa.Schedule == "" {
+			return nil, fmt.Errorf("scheduled action requires name and schedule")
+		}
+		if actionNames[sa.Name] {
+			return nil, fmt.Errorf("scheduled action %s is duplicated", sa.Name)
+		}
+		if sa.MinCapacity == nil && sa.MaxCapacity == nil {
+			return nil, fmt.Errorf("scheduled action %s requires min_capacity or max_capacity", sa.Name)
+		}
+		actionNames[sa.Name] = true
+
+		action := &applicationautoscaling.PutScheduledActionInput{
+			ResourceId:          aws.String(resourceID),
+			ScalableDimension:   aws.String(applicationautoscaling.ScalableDimensionEcsServiceDesiredCount),
+			ServiceNamespace:    aws.String(applicationautoscaling.ServiceNamespaceEcs),
+			ScheduledActionName: aws.String(sa.Name),
+			Schedule:            aws.String(sa.Schedule),
+			ScalableTargetAction: &applicationautoscaling.ScalableTargetAction{
+				MinCapacity: sa.MinCapacity,
+				MaxCapacity: sa.MaxCapacity,
+			},
+		}
+		if sa.Timezone != "" {
+			action.Timezone = aws.String(sa.Timezone)
+		}
+		def.ScheduledActions = append(def.ScheduledActions, action)
+	}
+
+	sortAutoScalingDefinition(def)
+	return def, nil
+}
+
+func sortAutoScalingDefinition(def *autoScalingDefinition) {
+	sort.Slice(def.Policies, func(i, j int) bool {
+		return *def.Policies[i].PolicyName < *def.Policies[j].PolicyName
+	})
+	sort.Slice(def.ScheduledActions, func(i, j int) bool {
+		return *def.ScheduledActions[i].ScheduledActionName < *def.ScheduledActions[j].ScheduledActionName
+	})
+}
+
+func validateAutoScaling(srv Service) error {
+	if srv.autoScaling == nil {
+		return nil
+	}
+	if equalString(srv.srv.SchedulingStrategy, ecs.SchedulingStrategyDaemon) {
+		return fmt.Errorf("autoscaling is not available for the DAEMON scheduling strategy")
+	}
+	_, err := buildAutoScaling("", srv.autoScaling)
+	return err
+}
+
+func clampDesiredCount(count *int64, min *int64, max *int64) *int64 {
+	if count == nil || *count < *min {
+		return min
+	}
+	if *count > *max {
+		return max
+	}
+	return count
+}
+
+// initialDesiredCount keeps the desired count of a new service within the autoscaling capacity
+func initialDesiredCount(srv Service) *int64 {
+	c := srv.autoScaling
+	if c == nil || c.MinCapacity == nil || c.MaxCapacity == nil {
+		return srv.srv.DesiredCount
+	}
+	return clampDesiredCount(srv.srv.DesiredCount, c.MinCapacity, c.MaxCapacity)
+}
+
+// describeScalableTarget returns the scalable target of the service, or nil if it's not registered
+func (a *App) describeScalableTarget(ctx context.Context, fullname string) (*applicationautoscaling.ScalableTarget, error) {
+	out, err := a.autoScaling.DescribeScalableTargetsWithContext(ctx, &applicationautoscaling.DescribeScalableTargetsInput{
+		ResourceIds:       aws.StringSlice([]string{autoScalingResourceID(a.def.cluster, fullname)}),
+		ScalableDimension: aws.String(applicationautoscaling.ScalableDimensionEcsServiceDesiredCount),
+		ServiceNamespace:  aws.String(applicationautoscaling.ServiceNamespaceEcs),
+	})
+	if err != nil {
+		if awsErr, ok := err.(awserr.Error); ok && awsErr.Code() == "AccessDeniedException" {
+			a.DebugLog("unable to describe scalable targets. the desired count in config is used.")
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to describe scalable targets: %w", err)
+	}
+	if len(out.ScalableTargets) == 0 {
+		return nil, nil
+	}
+	return out.ScalableTargets[0], nil
+}
+
+// deregisterScalableTarget deregisters the scalable target with its policies and scheduled actions
+func (a *App) deregisterScalableTarget(ctx context.Context, target *applicationautoscaling.ScalableTarget) error {
+	_, err := a.autoScaling.DeregisterScalableTargetWithContext(ctx, &applicationautoscaling.DeregisterScalableTargetInput{
+		ResourceId:        target.ResourceId,
+		ScalableDimension: target.ScalableDimension,
+		ServiceNamespace:  target.ServiceNamespace,
+	})
+	return err
+}
+
+// createDesiredCount resolves the desired count of a service to create.
+// A registered scalable target owns the desired count, so it's kept within the capacity of the target.
+func (a *App) createDesiredCount(ctx context.Context, fullname string, srv Service) (*int64, error) {
+	target, err := a.describeScalableTarget(ctx, fullname)
+	if err != nil {
+		return nil, err
+	}
+	if target != nil {
+		return clampDesiredCount(srv.srv.DesiredCount, target.MinCapacity, target.MaxCapacity), nil
+	}
+	return initialDesiredCount(srv), nil
+}
+
+func (a *App) describeAutoScalingDefinition(ctx context.Context, resourceID string) (*autoScalingDefinition, error) {
+	def := &autoScalingDefinition{
+		Policies:         []*applicationautoscaling.PutScalingPolicyInput{},
+		ScheduledActions: []*applicationautoscaling.PutScheduledActionInput{},
+	}
+
+	tout, err := a.autoScaling.DescribeScalableTargetsWithContext(ctx, &applicationautoscaling.DescribeScalableTargetsInput{
+		ResourceIds:       aws.StringSlice([]string{resourceID}),
+		ScalableDimension: aws.String(applicationautoscaling.ScalableDimensionEcsServiceDesiredCount),
+		ServiceNamespace:  aws.String(applicationautoscaling.ServiceNamespaceEcs),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe scalable targets: %w", err)
+	}
+	for _, t := range tout.ScalableTargets {
+		def.Target = &applicationautoscaling.RegisterScalableTargetInput{
+			MinCapacity:       t.MinCapacity,
+			MaxCapacity:       t.MaxCapacity,
+			ResourceId:        t.ResourceId,
+			ScalableDimension: t.ScalableDimension,
+			ServiceNamespace:  t.ServiceNamespace,
+		}
+	}
+
+	err = a.autoScaling.DescribeScalingPoliciesPagesWithContext(ctx,
+		&applicationautoscaling.DescribeScalingPoliciesInput{
+			ResourceId:        aws.String(resourceID),
+			ScalableDimension: aws.String(applicationautoscaling.ScalableDimensionEcsServiceDesiredCount),
+			ServiceNamespace:  aws.String(applicationautoscaling.ServiceNamespaceEcs),
+		},
+		func(out *applicationautoscaling.DescribeScalingPoliciesOutput, lastPage bool) bool {
+			for _, p := range out.ScalingPolicies {
+				def.Policies = append(def.Policies, &applicationautoscaling.PutScalingPolicyInput{
+					PolicyName:                               p.PolicyName,
+					PolicyType:                               p.PolicyType,
+					ResourceId:                               p.ResourceId,
+					ScalableDimension:                        p.ScalableDimension,
+					ServiceNamespace:                         p.ServiceNamespace,
+					StepScalingPolicyConfiguration:           p.StepScalingPolicyConfiguration,
+					TargetTrackingScalingPolicyConfiguration: p.TargetTrackingScalingPolicyConfiguration,
+				})
+			}
+			return true
+		},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe scaling policies: %w", err)
+	}
+
+	err = a.autoScaling.DescribeScheduledActionsPagesWithContext(ctx,
+		&applicationautoscaling.DescribeScheduledActionsInput{
+			ResourceId:        aws.String(resourceID),
+			ScalableDimension: aws.String(applicationautoscaling.ScalableDimensionEcsServiceDesiredCount),
+			ServiceNamespace:  aws.String(applicationautoscaling.ServiceNamespaceEcs),
+		},
+		func(out *applicationautoscaling.DescribeScheduledActionsOutput, lastPage bool) bool {
+			for _, s := range out.ScheduledActions {
+				def.ScheduledActions = append(def.ScheduledActions, &applicationautoscaling.PutScheduledActionInput{
+					ResourceId:           s.ResourceId,
+					ScalableDimension:    s.ScalableDimension,
+					ServiceNamespace:     s.ServiceNamespace,
+					ScheduledActionName:  s.ScheduledActionName,
+					Schedule:             s.Schedule,
+					ScalableTargetAction: s.ScalableTargetAction,
+					Timezone:             s.Timezone,
+				})
+			}
+			return true
+		},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe scheduled actions: %w", err)
+	}
+
+	sortAutoScalingDefinition(def)
+	return def, nil
+}
+
+func diffAutoScaling(curr *autoScalingDefinition, next *autoScalingDefinition) (string, error) {
+	currBytes, err := MarshalJSON(curr)
+	if err != nil {
+		return "", err
+	}
+	nextBytes, err := MarshalJSON(next)
+	if err != nil {
+		return "", err
+	}
+	return diff.Diff(string(currBytes), string(nextBytes)), nil
+}
+
+// applyAutoScaling registers the scalable targets of the services and puts the policies and scheduled actions.
+// Policies and scheduled actions which are not in config are deleted.
+func (a *App) applyAutoScaling(ctx context.Context, opt DeployOption, names []string) error {
+	for _, name := range names {
+		srv := a.def.nameToSrv[name]
+		if srv.autoScaling == nil {
+			continue
+		}
+		fullname := a.resolveFullName(name)
+		resourceID := autoScalingResourceID(a.def.cluster, fullname)
+
+		next, err := buildAutoScaling(resourceID, srv.autoScaling)
+		if err != nil {
+			return fmt.Errorf("service %s: %w", name, err)
+		}
+		curr, err := a.describeAutoScalingDefinition(ctx, resourceID)
+		if err != nil {
+			return err
+		}
+
+		if opt.DryRun {
+			d, err := diffAutoScaling(curr, next)
+			if err != nil {
+				return err
+			}
+			color.Green("~ autoscaling: %s", fullname)
+			fmt.Println(d)
+			continue
+		}
+
+		if err := a.putAutoScaling(ctx, curr, next); err != nil {
+			return fmt.Errorf("failed to apply autoscaling of %s: %w", fullname, err)
+		}
+		a.Log(LogDone(), "Applied autoscaling", LogTarget(fullname))
+	}
+	return nil
+}
+
+func (a *App) putAutoScaling(ctx context.Context, curr *autoScalingDefinition, next *autoScalingDefinition) error {
+	if _, err := a.autoScaling.RegisterScalableTargetWithContext(ctx, next.Target); err != nil {
+		return err
+	}
+
+	policies := map[string]bool{}
+	for _, p := range next.Policies {
+		policies[*p.PolicyName] = true
+		if _, err := a.autoScaling.PutScalingPolicyWithContext(ctx, p); err != nil {
+			return err
+		}
+	}
+	for _, p := range curr.Policies {
+		if policies[*p.PolicyName] {
+			continue
+		}
+		a.Log("Deleting scaling policy", LogTarget(*p.PolicyName))
+		if _, err := a.autoScaling.DeleteScalingPolicyWithContext(ctx, &applicationautoscaling.DeleteScalingPolicyInput{
+			PolicyName:        p.PolicyName,
+			ResourceId:        p.ResourceId,
+			ScalableDimension: p.ScalableDimension,
+			ServiceNamespace:  p.ServiceNamespace,
+		}); err != nil {
+			return err
+		}
+	}
+
+	actions := map[string]bool{}
+	for _, s := range next.ScheduledActions {
+		actions[*s.ScheduledActionName] = true
+		if _, err := a.autoScaling.PutScheduledActionWithContext(ctx, s); err != nil {
+			return err
+		}
+	}
+	for _, s := range curr.ScheduledActions {
+		if actions[*s.ScheduledActionName] {
+			continue
+		}
+		a.Log("Deleting scheduled action", LogTarget(*s.ScheduledActionName))
+		if _, err := a.autoScaling.DeleteScheduledActionWithContext(ctx, &applicationautoscaling.DeleteScheduledActionInput{
+			ScheduledActionName: s.ScheduledActionName,
+			ResourceId:          s.ResourceId,
+			ScalableDimension:   s.ScalableDimension,
+			ServiceNamespace:    s.ServiceNamespace,
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
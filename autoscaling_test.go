@@ -0,0 +1,87 @@
+package ecsceed
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildAutoScaling(t *testing.T) {
+	c := &ConfigAutoScaling{
+		MinCapacity: aws.Int64(2),
+		MaxCapacity: aws.Int64(10),
+		TargetTracking: []ConfigTargetTracking{
+			{Name: "cpu", PredefinedMetric: "ECSServiceAverageCPUUtilization", TargetValue: 60, ScaleInCooldown: "5m"},
+		},
+		StepScaling: []ConfigStepScaling{
+			{Name: "queue", AdjustmentType: "ChangeInCapacity", Steps: []ConfigStepAdjustment{
+				{LowerBound: aws.Float64(0), Adjustment: 2},
+			}},
+		},
+		ScheduledActions: []ConfigScheduledAction{
+			{Name: "night", Schedule: "cron(0 22 * * ? *)", Timezone: "Asia/Tokyo", MinCapacity: aws.Int64(0), MaxCapacity: aws.Int64(0)},
+		},
+	}
+	def, err := buildAutoScaling("service/default/api", c)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), *def.Target.MinCapacity)
+	assert.Equal(t, "service/default/api", *def.Target.ResourceId)
+	if assert.Len(t, def.Policies, 2) {
+		assert.Equal(t, "cpu", *def.Policies[0].PolicyName)
+		assert.Equal(t, int64(300), *def.Policies[0].TargetTrackingScalingPolicyConfiguration.ScaleInCooldown)
+		assert.Nil(t, def.Policies[0].TargetTrackingScalingPolicyConfiguration.ScaleOutCooldown)
+		assert.Equal(t, "queue", *def.Policies[1].PolicyName)
+		assert.Equal(t, "StepScaling", *def.Policies[1].PolicyType)
+	}
+	if assert.Len(t, def.ScheduledActions, 1) {
+		assert.Equal(t, "Asia/Tokyo", *def.ScheduledActions[0].Timezone)
+	}
+
+	_, err = buildAutoScaling("", &ConfigAutoScaling{MinCapacity: aws.Int64(3), MaxCapacity: aws.Int64(2)})
+	assert.Error(t, err)
+	_, err = buildAutoScaling("", &ConfigAutoScaling{MaxCapacity: aws.Int64(2)})
+	assert.Error(t, err)
+	_, err = buildAutoScaling("", &ConfigAutoScaling{
+		MinCapacity: aws.Int64(1),
+		MaxCapacity: aws.Int64(2),
+		TargetTracking: []ConfigTargetTracking{
+			{Name: "cpu", PredefinedMetric: "ECSServiceAverageCPUUtilization", TargetValue: 60},
+			{Name: "cpu", PredefinedMetric: "ECSServiceAverageMemoryUtilization", TargetValue: 60},
+		},
+	})
+	assert.Error(t, err)
+
+	err = validateAutoScaling(Service{
+		srv:         ecs.Service{SchedulingStrategy: aws.String(ecs.SchedulingStrategyDaemon)},
+		autoScaling: &ConfigAutoScaling{MinCapacity: aws.Int64(1), MaxCapacity: aws.Int64(2)},
+	})
+	assert.Error(t, err)
+}
+
+func TestInitialDesiredCount(t *testing.T) {
+	c := &ConfigAutoScaling{MinCapacity: aws.Int64(2), MaxCapacity: aws.Int64(10)}
+	assert.Equal(t, int64(2), *initialDesiredCount(Service{autoScaling: c}))
+	assert.Equal(t, int64(2), *initialDesiredCount(Service{srv: ecs.Service{DesiredCount: aws.Int64(1)}, autoScaling: c}))
+	assert.Equal(t, int64(5), *initialDesiredCount(Service{srv: ecs.Service{DesiredCount: aws.Int64(5)}, autoScaling: c}))
+	assert.Equal(t, int64(10), *initialDesiredCount(Service{srv: ecs.Service{DesiredCount: aws.Int64(20)}, autoScaling: c}))
+	assert.Equal(t, int64(20), *initialDesiredCount(Service{srv: ecs.Service{DesiredCount: aws.Int64(20)}}))
+}
+
+func TestDiffAutoScaling(t *testing.T) {
+	c := &ConfigAutoScaling{MinCapacity: aws.Int64(2), MaxCapacity: aws.Int64(10)}
+	next, err := buildAutoScaling("service/default/api", c)
+	assert.NoError(t, err)
+
+	d, err := diffAutoScaling(&autoScalingDefinition{}, next)
+	assert.NoError(t, err)
+	assert.Contains(t, d, `+    "MaxCapacity": 10,`)
+
+	same, err := buildAutoScaling("service/default/api", c)
+	assert.NoError(t, err)
+	d, err = diffAutoScaling(same, next)
+	assert.NoError(t, err)
+	assert.NotContains(t, d, "\n+")
+	assert.NotContains(t, d, "\n-")
+}
@@ -0,0 +1,437 @@
+package ecsceed
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/fatih/color"
+	"github.com/pkg/errors"
+)
+
+type canaryStep struct {
+	weight float64
+	pause  time.Duration
+}
+
+// without canary config, the new task set replaces the primary at once
+var defaultCanarySteps = []canaryStep{{weight: 100}}
+
+type CanaryOption struct {
+	Services         []string
+	ExcludeServices  []string
+	Timeout          time.Duration
+	FailureThreshold int
+	WaitForLock      time.Duration
+}
+
+func (opt CanaryOption) waitOption() WaitOption {
+	return WaitOption{
+		Timeout:          opt.Timeout,
+		FailureThreshold: opt.FailureThreshold,
+	}
+}
+
+func isExternalService(srv ecs.Service) bool {
+	return srv.DeploymentController != nil && equalString(srv.DeploymentController.Type, ecs.DeploymentControllerTypeExternal)
+}
+
+func canarySteps(c *ConfigCanary) ([]canaryStep, error) {
+	if c == nil || len(c.Steps) == 0 {
+		return defaultCanarySteps, nil
+	}
+	steps := []canaryStep{}
+	var prev float64
+	for _, s := range c.Steps {
+		if s.Weight <= prev || s.Weight > 100 {
+			return nil, fmt.Errorf("canary weights must increase within 100: %v", s.Weight)
+		}
+		prev = s.Weight
+
+		step := canaryStep{weight: s.Weight}
+		if s.Pause != "" {
+			d, err := time.ParseDuration(s.Pause)
+			if err != nil {
+				return nil, fmt.Errorf("invalid canary pause %s: %w", s.Pause, err)
+			}
+			step.pause = d
+		}
+		steps = append(steps, step)
+	}
+	return steps, nil
+}
+
+func formatCanarySteps(steps []canaryStep) string {
+	ss := []string{}
+	for _, s := range steps {
+		ss = append(ss, fmt.Sprintf("%v%%", s.weight))
+	}
+	return strings.Join(ss, " -> ")
+}
+
+func primaryTaskSet(s *ecs.Service) *ecs.TaskSet {
+	for _, ts := range s.TaskSets {
+		if *ts.Status == "PRIMARY" {
+			return ts
+		}
+	}
+	return nil
+}
+
+// canaryTaskSets are the active task sets other than the primary, the newest first
+func canaryTaskSets(s *ecs.Service) []*ecs.TaskSet {
+	sets := []*ecs.TaskSet{}
+	for _, ts := range s.TaskSets {
+		if *ts.Status == "ACTIVE" {
+			sets = append(sets, ts)
+		}
+	}
+	sort.Slice(sets, func(i, j int) bool {
+		return aws.TimeValue(sets[i].CreatedAt).After(aws.TimeValue(sets[j].CreatedAt))
+	})
+	return sets
+}
+
+func taskSetScale(weight float64) *ecs.Scale {
+	return &ecs.Scale{
+		Unit:  aws.String(ecs.ScaleUnitPercent),
+		Value: aws.Float64(weight),
+	}
+}
+
+func (a *App) createTaskSet(ctx context.Context, fullname string, srv ecs.Service, tdArn string, weight float64) (*ecs.TaskSet, error) {
+	out, err := a.ecs.CreateTaskSetWithContext(ctx, &ecs.CreateTaskSetInput{
+		Cluster:                  aws.String(a.def.cluster),
+		Service:                  aws.String(fullname),
+		TaskDefinition:           aws.String(tdArn),
+		ExternalId:               aws.String("ecsceed:" + arnToName(tdArn)),
+		CapacityProviderStrategy: srv.CapacityProviderStrategy,
+		LaunchType:               srv.LaunchType,
+		LoadBalancers:            srv.LoadBalancers,
+		NetworkConfiguration:     srv.NetworkConfiguration,
+		PlatformVersion:          srv.PlatformVersion,
+		ServiceRegistries:        srv.ServiceRegistries,
+		Scale:                    taskSetScale(weight),
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create task set")
+	}
+	a.Log(LogDone(), "Created task set", LogTarget(*out.TaskSet.Id), "of", LogTarget(arnToName(tdArn)), fmt.Sprintf("at %v%%", weight))
+	return out.TaskSet, nil
+}
+
+func (a *App) scaleTaskSet(ctx context.Context, fullname string, id string, weight float64) error {
+	_, err := a.ecs.UpdateTaskSetWithContext(ctx, &ecs.UpdateTaskSetInput{
+		Cluster: aws.String(a.def.cluster),
+		Service: aws.String(fullname),
+		TaskSet: aws.String(id),
+		Scale:   taskSetScale(weight),
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to scale task set")
+	}
+	a.Log(LogDone(), "Scaled task set", LogTarget(id), fmt.Sprintf("to %v%%", weight))
+	return nil
+}
+
+func (a *App) deleteTaskSet(ctx context.Context, fullname string, id string) error {
+	_, err := a.ecs.DeleteTaskSetWithContext(ctx, &ecs.DeleteTaskSetInput{
+		Cluster: aws.String(a.def.cluster),
+		Service: aws.String(fullname),
+		TaskSet: aws.String(id),
+		Force:   aws.Bool(true),
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to delete task set")
+	}
+	a.Log(LogDone(), "Deleted task set", LogTarget(id))
+	return nil
+}
+
+func (a *App) setPrimaryTaskSet(ctx context.Context, fullname string, id string) error {
+	_, err := a.ecs.UpdateServicePrimaryTaskSetWithContext(ctx, &ecs.UpdateServicePrimaryTaskSetInput{
+		Cluster:        aws.String(a.def.cluster),
+		Service:        aws.String(fullname),
+		PrimaryTaskSet: aws.String(id),
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to update primary task set")
+	}
+	a.Log(LogDone(), "Promoted task set", LogTarget(id), "to primary of", LogTarget(fullname))
+	return nil
+}
+
+// waitTaskSetStable waits until the task set reaches the steady state, and fails fast like WaitServiceStable
+func (a *App) waitTaskSetStable(ctx context.Context, fullname string, ts *ecs.TaskSet, startedAt time.Time, opt WaitOption) error {
+	a.Log("Waiting for task set stable...")
+	if opt.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opt.Timeout)
+		defer cancel()
+	}
+	threshold := opt.FailureThreshold
+	if threshold <= 0 {
+		threshold = defaultFailureThreshold
+	}
+	timedOut := func() error {
+		return fmt.Errorf("timed out after %s waiting for task set stable", opt.Timeout)
+	}
+
+	for {
+		out, err := a.ecs.DescribeTaskSetsWithContext(ctx, &ecs.DescribeTaskSetsInput{
+			Cluster:  aws.String(a.def.cluster),
+			Service:  aws.String(fullname),
+			TaskSets: []*string{ts.Id},
+		})
+		if err != nil {
+			if ctx.Err() == context.DeadlineExceeded {
+				return timedOut()
+			}
+			return err
+		}
+		if len(out.TaskSets) == 0 {
+			return fmt.Errorf("task set %s is not found", *ts.Id)
+		}
+		curr := out.TaskSets[0]
+		if equalString(curr.StabilityStatus, ecs.StabilityStatusSteadyState) && *curr.RunningCount == *curr.ComputedDesiredCount {
+			return nil
+		}
+		a.DebugLog("task set", *curr.Id, "running:", *curr.RunningCount, "desired:", *curr.ComputedDesiredCount)
+
+		tasks, err := a.ListStoppedServiceTasks(ctx, fullname, *ts.TaskDefinition, startedAt)
+		if err != nil {
+			return err
+		}
+		if err := checkStoppedTasks(tasks, threshold); err != nil {
+			return fmt.Errorf("task set %s failed: %w", *ts.Id, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			if ctx.Err() == context.DeadlineExceeded {
+				return timedOut()
+			}
+			return ctx.Err()
+		case <-time.After(waitServiceInterval):
+		}
+	}
+}
+
+// updateCanaryService deploys the task definition as a new task set and shifts it by the canary steps
+func (a *App) updateCanaryService(ctx context.Context, opt DeployOption, name string, nameToTdArn map[string]string) error {
+	srv := a.def.nameToSrv[name]
+	fullname := a.resolveFullName(name)
+	steps, err := canarySteps(srv.canary)
+	if err != nil {
+		return err
+	}
+	autoPromote := srv.canary == nil || srv.canary.AutoPromote
+
+	if opt.DryRun {
+		color.Green("~ service with canary task set: %s steps=%s", fullname, formatCanarySteps(steps))
+		return nil
+	}
+
+	tdArn, ok := nameToTdArn[srv.taskDefinition]
+	if !ok {
+		return fmt.Errorf("Bad reference service to task definition")
+	}
+
+	if opt.UpdateService {
+		// the others are carried by task sets or not updatable with the EXTERNAL deployment controller
+		attrs := srv.srv
+		attrs.CapacityProviderStrategy = nil
+		attrs.DeploymentConfiguration = nil
+		attrs.NetworkConfiguration = nil
+		attrs.PlatformVersion = nil
+		if _, err := a.UpdateServiceAttributes(ctx, &attrs, fullname, nil); err != nil {
+			return err
+		}
+	}
+
+	curr, err := a.DescribeService(ctx, &fullname)
+	if err != nil {
+		return err
+	}
+	if len(canaryTaskSets(curr)) > 0 {
+		return fmt.Errorf("service %s has a canary task set in progress. promote or abort it first", fullname)
+	}
+
+	startedAt := time.Now()
+
+	// the first task set of the service
+	primary := primaryTaskSet(curr)
+	if primary == nil {
+		ts, err := a.createTaskSet(ctx, fullname, srv.srv, tdArn, 100)
+		if err != nil {
+			return err
+		}
+		if err := a.setPrimaryTaskSet(ctx, fullname, *ts.Id); err != nil {
+			return err
+		}
+		if opt.NoWait {
+			return nil
+		}
+		return a.waitTaskSetStable(ctx, fullname, ts, startedAt, opt.waitOption())
+	}
+
+	ts, err := a.createTaskSet(ctx, fullname, srv.srv, tdArn, steps[0].weight)
+	if err != nil {
+		return err
+	}
+	abort := func(err error) error {
+		a.Log(color.RedString("Canary failed: %s", err))
+		if derr := a.deleteTaskSet(cleanupContext(), fullname, *ts.Id); derr != nil {
+			return fmt.Errorf("canary of %s failed: %v, and failed to abort: %w", fullname, err, derr)
+		}
+		return fmt.Errorf("canary of %s is aborted: %w", fullname, err)
+	}
+
+	if opt.NoWait {
+		a.Log("Canary task set", LogTarget(*ts.Id), "is created. Run promote or abort to finish it")
+		return nil
+	}
+
+	for i, step := range steps {
+		if i > 0 {
+			if err := a.scaleTaskSet(ctx, fullname, *ts.Id, step.weight); err != nil {
+				return abort(err)
+			}
+		}
+		a.Log(fmt.Sprintf("Canary step %d/%d: %v%%", i+1, len(steps), step.weight), LogTarget(fullname))
+		if err := a.waitTaskSetStable(ctx, fullname, ts, startedAt, opt.waitOption()); err != nil {
+			return abort(err)
+		}
+
+		if step.pause > 0 && (i < len(steps)-1 || autoPromote) {
+			a.Log("Pausing for", step.pause)
+			select {
+			case <-ctx.Done():
+				return abort(ctx.Err())
+			case <-time.After(step.pause):
+			}
+		}
+	}
+
+	if !autoPromote {
+		a.Log("Canary task set", LogTarget(*ts.Id), fmt.Sprintf("is running at %v%%.", steps[len(steps)-1].weight), "Run promote or abort to finish it")
+		return nil
+	}
+	return a.promoteTaskSet(ctx, fullname, ts, opt.waitOption())
+}
+
+// promoteTaskSet scales the task set to 100%, makes it primary and deletes the others
+func (a *App) promoteTaskSet(ctx context.Context, fullname string, ts *ecs.TaskSet, opt WaitOption) error {
+	if ts.Scale == nil || aws.Float64Value(ts.Scale.Value) < 100 {
+		if err := a.scaleTaskSet(ctx, fullname, *ts.Id, 100); err != nil {
+			return err
+		}
+		if err := a.waitTaskSetStable(ctx, fullname, ts, time.Now(), opt); err != nil {
+			return err
+		}
+	}
+	if err := a.setPrimaryTaskSet(ctx, fullname, *ts.Id); err != nil {
+		return err
+	}
+
+	curr, err := a.DescribeService(ctx, &fullname)
+	if err != nil {
+		return err
+	}
+	for _, other := range curr.TaskSets {
+		if *other.Id == *ts.Id || *other.Status == "DRAINING" {
+			continue
+		}
+		if err := a.deleteTaskSet(ctx, fullname, *other.Id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// canaryServices resolves the selected services with the EXTERNAL deployment controller
+func (a *App) canaryServices(ctx context.Context, opt CanaryOption) ([]*ecs.Service, error) {
+	err := a.ResolveConfigStack(Params{})
+	if err != nil {
+		return nil, err
+	}
+	names, err := a.selectServices(opt.Services, opt.ExcludeServices)
+	if err != nil {
+		return nil, err
+	}
+	external := []string{}
+	for _, name := range names {
+		if isExternalService(a.def.nameToSrv[name].srv) {
+			external = append(external, name)
+		}
+	}
+	if len(external) == 0 {
+		return nil, errors.New("no services with the EXTERNAL deployment controller")
+	}
+	desc, err := a.DescribeServices(ctx, a.serviceFullNames(external))
+	if err != nil {
+		return nil, err
+	}
+	return desc.Services, nil
+}
+
+// Promote makes the newest canary task sets primary
+func (a *App) Promote(ctx context.Context, opt CanaryOption) error {
+	release, err := a.acquireLock(ctx, "promote", opt.WaitForLock)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	services, err := a.canaryServices(ctx, opt)
+	if err != nil {
+		return err
+	}
+	for _, s := range services {
+		canaries := canaryTaskSets(s)
+		if len(canaries) == 0 {
+			a.Log("No canary task set", LogTarget(*s.ServiceName))
+			continue
+		}
+		if err := a.promoteTaskSet(ctx, *s.ServiceName, canaries[0], opt.waitOption()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Abort deletes the canary task sets and restores the primary task set to 100%
+func (a *App) Abort(ctx context.Context, opt CanaryOption) error {
+	release, err := a.acquireLock(ctx, "abort", opt.WaitForLock)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	services, err := a.canaryServices(ctx, opt)
+	if err != nil {
+		return err
+	}
+	for _, s := range services {
+		canaries := canaryTaskSets(s)
+		if len(canaries) == 0 {
+			a.Log("No canary task set", LogTarget(*s.ServiceName))
+			continue
+		}
+		if primary := primaryTaskSet(s); primary != nil && (primary.Scale == nil || aws.Float64Value(primary.Scale.Value) < 100) {
+			if err := a.scaleTaskSet(ctx, *s.ServiceName, *primary.Id, 100); err != nil {
+				return err
+			}
+		}
+		for _, ts := range canaries {
+			if err := a.deleteTaskSet(ctx, *s.ServiceName, *ts.Id); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
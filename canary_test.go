@@ -0,0 +1,57 @@
+package ecsceed
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCanarySteps(t *testing.T) {
+	steps, err := canarySteps(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, defaultCanarySteps, steps)
+
+	steps, err = canarySteps(&ConfigCanary{
+		Steps: []ConfigCanaryStep{
+			{Weight: 10, Pause: "5m"},
+			{Weight: 50, Pause: "10m"},
+			{Weight: 100},
+		},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []canaryStep{
+		{weight: 10, pause: 5 * time.Minute},
+		{weight: 50, pause: 10 * time.Minute},
+		{weight: 100},
+	}, steps)
+	assert.Equal(t, "10% -> 50% -> 100%", formatCanarySteps(steps))
+
+	_, err = canarySteps(&ConfigCanary{Steps: []ConfigCanaryStep{{Weight: 50}, {Weight: 10}}})
+	assert.Error(t, err)
+	_, err = canarySteps(&ConfigCanary{Steps: []ConfigCanaryStep{{Weight: 150}}})
+	assert.Error(t, err)
+	_, err = canarySteps(&ConfigCanary{Steps: []ConfigCanaryStep{{Weight: 10, Pause: "soon"}}})
+	assert.Error(t, err)
+}
+
+func TestCanaryTaskSets(t *testing.T) {
+	now := time.Now()
+	s := &ecs.Service{
+		TaskSets: []*ecs.TaskSet{
+			{Id: aws.String("ecs-svc/1"), Status: aws.String("PRIMARY"), CreatedAt: aws.Time(now.Add(-time.Hour))},
+			{Id: aws.String("ecs-svc/2"), Status: aws.String("ACTIVE"), CreatedAt: aws.Time(now.Add(-time.Minute))},
+			{Id: aws.String("ecs-svc/3"), Status: aws.String("ACTIVE"), CreatedAt: aws.Time(now)},
+			{Id: aws.String("ecs-svc/4"), Status: aws.String("DRAINING"), CreatedAt: aws.Time(now)},
+		},
+	}
+	assert.Equal(t, "ecs-svc/1", *primaryTaskSet(s).Id)
+
+	canaries := canaryTaskSets(s)
+	if assert.Len(t, canaries, 2) {
+		assert.Equal(t, "ecs-svc/3", *canaries[0].Id)
+		assert.Equal(t, "ecs-svc/2", *canaries[1].Id)
+	}
+}
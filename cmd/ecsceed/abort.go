@@ -0,0 +1,58 @@
+package main
+
+import (
+	"os"
+
+	"github.com/maruware/ecsceed"
+
+	"github.com/urfave/cli/v2"
+)
+
+func abortCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "abort",
+		Usage: "delete canary task sets",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:     "config",
+				Aliases:  []string{"c"},
+				Required: true,
+				Usage:    "specify config path",
+			},
+			&cli.StringSliceFlag{
+				Name:    "service",
+				Aliases: []string{"s"},
+				Usage:   "target service name",
+			},
+			&cli.StringSliceFlag{
+				Name:  "exclude-service",
+				Usage: "excluded service name",
+			},
+			&cli.DurationFlag{
+				Name:  "wait-for-lock",
+				Usage: "wait for the deploy lock of the other up to the duration",
+			},
+		},
+		Action: func(c *cli.Context) error {
+			config := c.String("config")
+			services := c.StringSlice("service")
+			excludeServices := c.StringSlice("exclude-service")
+			waitForLock := c.Duration("wait-for-lock")
+
+			app, err := ecsceed.NewApp(config)
+			if err != nil {
+				return err
+			}
+
+			if len(os.Getenv("DEBUG")) > 0 {
+				app.Debug = true
+			}
+
+			return app.Abort(c.Context, ecsceed.CanaryOption{
+				Services:        services,
+				ExcludeServices: excludeServices,
+				WaitForLock:     waitForLock,
+			})
+		},
+	}
+}
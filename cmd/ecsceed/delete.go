@@ -2,6 +2,7 @@ package main
 
 import (
 	"os"
+	"time"
 
 	"github.com/maruware/ecsceed"
 
@@ -23,11 +24,50 @@ func deleteCommand() *cli.Command {
 				Name:  "dry-run",
 				Usage: "dry run",
 			},
+			&cli.StringSliceFlag{
+				Name:    "service",
+				Aliases: []string{"s"},
+				Usage:   "target service name",
+			},
+			&cli.StringSliceFlag{
+				Name:  "exclude-service",
+				Usage: "excluded service name",
+			},
+			&cli.DurationFlag{
+				Name:  "wait-for-lock",
+				Usage: "wait for the deploy lock of the other up to the duration",
+			},
+			&cli.DurationFlag{
+				Name:  "timeout",
+				Usage: "timeout for waiting services deleted",
+				Value: 10 * time.Minute,
+			},
+			&cli.BoolFlag{
+				Name:  "deregister-task-definitions",
+				Usage: "deregister all revisions of the task definitions",
+			},
+			&cli.BoolFlag{
+				Name:  "delete-log-groups",
+				Usage: "delete the log groups of the task definitions",
+			},
+			&cli.BoolFlag{
+				Name:    "yes",
+				Aliases: []string{"y"},
+				Usage:   "skip the confirmation",
+			},
 		},
 		Action: func(c *cli.Context) error {
 			config := c.String("config")
 			dryRun := c.Bool("dry-run")
 
+			services := c.StringSlice("service")
+			excludeServices := c.StringSlice("exclude-service")
+			waitForLock := c.Duration("wait-for-lock")
+			timeout := c.Duration("timeout")
+			deregister := c.Bool("deregister-task-definitions")
+			deleteLogGroups := c.Bool("delete-log-groups")
+			yes := c.Bool("yes")
+
 			app, err := ecsceed.NewApp(config)
 			if err != nil {
 				return err
@@ -38,7 +78,14 @@ func deleteCommand() *cli.Command {
 			}
 
 			err = app.Delete(c.Context, ecsceed.DeleteOption{
-				DryRun: dryRun,
+				DryRun:                    dryRun,
+				Services:                  services,
+				ExcludeServices:           excludeServices,
+				WaitForLock:               waitForLock,
+				Timeout:                   timeout,
+				DeregisterTaskDefinitions: deregister,
+				DeleteLogGroups:           deleteLogGroups,
+				Yes:                       yes,
 			})
 			if err != nil {
 				return err
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/maruware/ecsceed"
 
@@ -46,6 +47,62 @@ func deployCommand() *cli.Command {
 				Name:  "dry-run",
 				Usage: "dry run",
 			},
+			&cli.BoolFlag{
+				Name:  "recreate-on-immutable-change",
+				Usage: "recreate services whose immutable fields are changed",
+			},
+			&cli.DurationFlag{
+				Name:  "timeout",
+				Usage: "timeout for waiting services stable",
+				Value: 10 * time.Minute,
+			},
+			&cli.IntFlag{
+				Name:  "failure-threshold",
+				Usage: "stopped tasks count to treat a deploy as failed",
+				Value: 3,
+			},
+			&cli.BoolFlag{
+				Name:  "auto-rollback",
+				Usage: "rollback services automatically when deploy fails",
+			},
+			&cli.StringFlag{
+				Name:  "git-sha",
+				Usage: "git sha recorded to task definitions (default: detected from the working tree)",
+			},
+			&cli.StringFlag{
+				Name:  "git-branch",
+				Usage: "git branch recorded to task definitions (default: detected from the working tree)",
+			},
+			&cli.StringSliceFlag{
+				Name:    "service",
+				Aliases: []string{"s"},
+				Usage:   "target service name",
+			},
+			&cli.StringSliceFlag{
+				Name:  "exclude-service",
+				Usage: "excluded service name",
+			},
+			&cli.StringSliceFlag{
+				Name:  "task-def",
+				Usage: "additional task definition name to register",
+			},
+			&cli.IntFlag{
+				Name:  "parallel",
+				Usage: "number of services updated concurrently",
+				Value: 1,
+			},
+			&cli.DurationFlag{
+				Name:  "wait-for-lock",
+				Usage: "wait for the deploy lock of the other up to the duration",
+			},
+			&cli.BoolFlag{
+				Name:  "prune",
+				Usage: "delete services and scheduled tasks managed by ecsceed which are removed from config",
+			},
+			&cli.BoolFlag{
+				Name:  "force",
+				Usage: "deploy even if alarms of the services are already in ALARM",
+			},
 		},
 		Action: func(c *cli.Context) error {
 			config := c.String("config")
@@ -65,6 +122,20 @@ func deployCommand() *cli.Command {
 			autoLogGroup := c.Bool("auto-loggroup")
 			noWait := c.Bool("no-wait")
 			dryRun := c.Bool("dry-run")
+			recreate := c.Bool("recreate-on-immutable-change")
+			timeout := c.Duration("timeout")
+			failureThreshold := c.Int("failure-threshold")
+			autoRollback := c.Bool("auto-rollback")
+			gitSHA := c.String("git-sha")
+			gitBranch := c.String("git-branch")
+
+			services := c.StringSlice("service")
+			excludeServices := c.StringSlice("exclude-service")
+			waitForLock := c.Duration("wait-for-lock")
+			taskDefs := c.StringSlice("task-def")
+			parallel := c.Int("parallel")
+			prune := c.Bool("prune")
+			force := c.Bool("force")
 
 			app, err := ecsceed.NewApp(config)
 			if err != nil {
@@ -76,12 +147,25 @@ func deployCommand() *cli.Command {
 			}
 
 			err = app.Deploy(c.Context, ecsceed.DeployOption{
-				AdditionalParams:   params,
-				UpdateService:      updateService,
-				ForceNewDeployment: forceNewDeploy,
-				AutoLogGroup:       autoLogGroup,
-				NoWait:             noWait,
-				DryRun:             dryRun,
+				AdditionalParams:          params,
+				UpdateService:             updateService,
+				ForceNewDeployment:        forceNewDeploy,
+				AutoLogGroup:              autoLogGroup,
+				NoWait:                    noWait,
+				DryRun:                    dryRun,
+				RecreateOnImmutableChange: recreate,
+				Timeout:                   timeout,
+				FailureThreshold:          failureThreshold,
+				AutoRollback:              autoRollback,
+				GitSHA:                    gitSHA,
+				GitBranch:                 gitBranch,
+				Services:                  services,
+				ExcludeServices:           excludeServices,
+				TaskDefinitions:           taskDefs,
+				Parallel:                  parallel,
+				WaitForLock:               waitForLock,
+				Prune:                     prune,
+				Force:                     force,
 			})
 			if err != nil {
 				return err
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/maruware/ecsceed"
+
+	"github.com/urfave/cli/v2"
+)
+
+func historyConfigFlag() *cli.StringFlag {
+	return &cli.StringFlag{
+		Name:    "config",
+		Aliases: []string{"c"},
+		Usage:   "specify config path",
+	}
+}
+
+// historyConfig accepts the config flag of either history or its subcommands
+func historyConfig(c *cli.Context) (string, error) {
+	for _, ctx := range c.Lineage() {
+		if config := ctx.String("config"); config != "" {
+			return config, nil
+		}
+	}
+	return "", fmt.Errorf("Required flag \"config\" not set")
+}
+
+func historyCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "history",
+		Usage: "list task definition revisions with deploy metadata",
+		Flags: []cli.Flag{
+			// not required because the required flags of the parent are checked before the subcommands
+			historyConfigFlag(),
+			&cli.StringSliceFlag{
+				Name:  "task-def",
+				Usage: "target task definition name",
+			},
+			&cli.IntFlag{
+				Name:  "limit",
+				Usage: "revisions num for each task definition",
+				Value: 10,
+			},
+		},
+		Action: func(c *cli.Context) error {
+			config, err := historyConfig(c)
+			if err != nil {
+				return err
+			}
+			taskDefs := c.StringSlice("task-def")
+			limit := c.Int("limit")
+
+			app, err := ecsceed.NewApp(config)
+			if err != nil {
+				return err
+			}
+
+			if len(os.Getenv("DEBUG")) > 0 {
+				app.Debug = true
+			}
+
+			return app.History(c.Context, ecsceed.HistoryOption{
+				TaskDefinitions: taskDefs,
+				Limit:           limit,
+			})
+		},
+		Subcommands: []*cli.Command{
+			{
+				Name:      "diff",
+				Usage:     "diff between revisions",
+				ArgsUsage: "<family> <revA> <revB>",
+				Flags: []cli.Flag{
+					historyConfigFlag(),
+				},
+				Action: func(c *cli.Context) error {
+					if c.NArg() != 3 {
+						return fmt.Errorf("Usage: history diff <family> <revA> <revB>")
+					}
+					config, err := historyConfig(c)
+					if err != nil {
+						return err
+					}
+
+					app, err := ecsceed.NewApp(config)
+					if err != nil {
+						return err
+					}
+
+					if len(os.Getenv("DEBUG")) > 0 {
+						app.Debug = true
+					}
+
+					return app.HistoryDiff(c.Context, c.Args().Get(0), c.Args().Get(1), c.Args().Get(2))
+				},
+			},
+		},
+	}
+}
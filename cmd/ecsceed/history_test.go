@@ -0,0 +1,39 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/urfave/cli/v2"
+)
+
+func runHistory(args ...string) error {
+	app := cli.NewApp()
+	app.Commands = []*cli.Command{historyCommand()}
+	return app.Run(append([]string{"ecsceed", "history"}, args...))
+}
+
+func TestHistoryCommandConfig(t *testing.T) {
+	err := runHistory()
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), `Required flag "config" not set`)
+	}
+
+	// the config flag of the subcommand is accepted
+	err = runHistory("diff", "-c", "testdata/missing.yml", "api", "11", "12")
+	if assert.Error(t, err) {
+		assert.NotContains(t, err.Error(), "Required flag")
+		assert.Contains(t, err.Error(), "missing.yml")
+	}
+
+	// so is the one of the parent
+	err = runHistory("-c", "testdata/missing.yml", "diff", "api", "11", "12")
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "missing.yml")
+	}
+
+	err = runHistory("diff", "api", "11", "12")
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), `Required flag "config" not set`)
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"os"
+
+	"github.com/maruware/ecsceed"
+
+	"github.com/urfave/cli/v2"
+)
+
+func lockCommand() *cli.Command {
+	configFlag := &cli.StringFlag{
+		Name:     "config",
+		Aliases:  []string{"c"},
+		Required: true,
+		Usage:    "specify config path",
+	}
+
+	return &cli.Command{
+		Name:  "lock",
+		Usage: "deploy lock",
+		Subcommands: []*cli.Command{
+			{
+				Name:  "status",
+				Usage: "show the deploy lock",
+				Flags: []cli.Flag{
+					configFlag,
+				},
+				Action: func(c *cli.Context) error {
+					config := c.String("config")
+
+					app, err := ecsceed.NewApp(config)
+					if err != nil {
+						return err
+					}
+
+					if len(os.Getenv("DEBUG")) > 0 {
+						app.Debug = true
+					}
+
+					return app.LockStatus(c.Context)
+				},
+			},
+			{
+				Name:  "release",
+				Usage: "release the deploy lock",
+				Flags: []cli.Flag{
+					configFlag,
+					&cli.BoolFlag{
+						Name:  "force",
+						Usage: "release the lock of the other",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					config := c.String("config")
+					force := c.Bool("force")
+
+					app, err := ecsceed.NewApp(config)
+					if err != nil {
+						return err
+					}
+
+					if len(os.Getenv("DEBUG")) > 0 {
+						app.Debug = true
+					}
+
+					return app.ReleaseLock(c.Context, ecsceed.ReleaseLockOption{
+						Force: force,
+					})
+				},
+			},
+		},
+	}
+}
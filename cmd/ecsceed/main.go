@@ -1,15 +1,20 @@
 package main
 
 import (
+	"context"
 	"log"
 	"os"
+	"os/signal"
+	"syscall"
 
+	"github.com/maruware/ecsceed"
 	"github.com/urfave/cli/v2"
 )
 
 func main() {
 	app := cli.NewApp()
 	app.Usage = "A ECS deployment tool"
+	app.Version = ecsceed.Version
 
 	app.Commands = []*cli.Command{
 		deployCommand(),
@@ -18,9 +23,26 @@ func main() {
 		deleteCommand(),
 		statusCommand(),
 		logsCommand(),
+		lockCommand(),
+		historyCommand(),
+		pruneCommand(),
+		pruneServicesCommand(),
+		promoteCommand(),
+		abortCommand(),
 	}
 
-	err := app.Run(os.Args)
+	// cancel on interrupt so that commands can clean up (e.g. auto rollback)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sigs
+		signal.Stop(sigs)
+		cancel()
+	}()
+
+	err := app.RunContext(ctx, os.Args)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"os"
+	"time"
+
+	"github.com/maruware/ecsceed"
+
+	"github.com/urfave/cli/v2"
+)
+
+func promoteCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "promote",
+		Usage: "promote canary task sets to primary",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:     "config",
+				Aliases:  []string{"c"},
+				Required: true,
+				Usage:    "specify config path",
+			},
+			&cli.StringSliceFlag{
+				Name:    "service",
+				Aliases: []string{"s"},
+				Usage:   "target service name",
+			},
+			&cli.StringSliceFlag{
+				Name:  "exclude-service",
+				Usage: "excluded service name",
+			},
+			&cli.DurationFlag{
+				Name:  "timeout",
+				Usage: "timeout for waiting task sets stable",
+				Value: 10 * time.Minute,
+			},
+			&cli.IntFlag{
+				Name:  "failure-threshold",
+				Usage: "stopped tasks count to treat a task set as failed",
+				Value: 3,
+			},
+			&cli.DurationFlag{
+				Name:  "wait-for-lock",
+				Usage: "wait for the deploy lock of the other up to the duration",
+			},
+		},
+		Action: func(c *cli.Context) error {
+			config := c.String("config")
+			services := c.StringSlice("service")
+			excludeServices := c.StringSlice("exclude-service")
+			timeout := c.Duration("timeout")
+			failureThreshold := c.Int("failure-threshold")
+			waitForLock := c.Duration("wait-for-lock")
+
+			app, err := ecsceed.NewApp(config)
+			if err != nil {
+				return err
+			}
+
+			if len(os.Getenv("DEBUG")) > 0 {
+				app.Debug = true
+			}
+
+			return app.Promote(c.Context, ecsceed.CanaryOption{
+				Services:         services,
+				ExcludeServices:  excludeServices,
+				Timeout:          timeout,
+				FailureThreshold: failureThreshold,
+				WaitForLock:      waitForLock,
+			})
+		},
+	}
+}
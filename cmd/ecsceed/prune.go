@@ -0,0 +1,76 @@
+package main
+
+import (
+	"os"
+
+	"github.com/maruware/ecsceed"
+
+	"github.com/urfave/cli/v2"
+)
+
+func pruneCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "prune",
+		Usage: "deregister old task definition revisions",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:     "config",
+				Aliases:  []string{"c"},
+				Required: true,
+				Usage:    "specify config path",
+			},
+			&cli.IntFlag{
+				Name:  "keep",
+				Usage: "number of the newest active revisions kept for each task definition",
+				Value: 10,
+			},
+			&cli.DurationFlag{
+				Name:  "keep-duration",
+				Usage: "keep revisions registered within the duration",
+			},
+			&cli.StringSliceFlag{
+				Name:  "task-def",
+				Usage: "target task definition name",
+			},
+			&cli.BoolFlag{
+				Name:  "dry-run",
+				Usage: "dry run",
+			},
+			&cli.BoolFlag{
+				Name:  "json",
+				Usage: "print the report as JSON",
+			},
+			&cli.DurationFlag{
+				Name:  "wait-for-lock",
+				Usage: "wait for the deploy lock of the other up to the duration",
+			},
+		},
+		Action: func(c *cli.Context) error {
+			config := c.String("config")
+			keep := c.Int("keep")
+			keepDuration := c.Duration("keep-duration")
+			taskDefs := c.StringSlice("task-def")
+			dryRun := c.Bool("dry-run")
+			jsonReport := c.Bool("json")
+			waitForLock := c.Duration("wait-for-lock")
+
+			app, err := ecsceed.NewApp(config)
+			if err != nil {
+				return err
+			}
+
+			if len(os.Getenv("DEBUG")) > 0 {
+				app.Debug = true
+			}
+
+			return app.Prune(c.Context, ecsceed.PruneOption{
+				Keep:            keep,
+				KeepDuration:    keepDuration,
+				TaskDefinitions: taskDefs,
+				DryRun:          dryRun,
+				JSON:            jsonReport,
+				WaitForLock:     waitForLock,
+			})
+		},
+	}
+}
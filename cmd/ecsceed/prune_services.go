@@ -0,0 +1,66 @@
+package main
+
+import (
+	"os"
+	"time"
+
+	"github.com/maruware/ecsceed"
+
+	"github.com/urfave/cli/v2"
+)
+
+func pruneServicesCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "prune-services",
+		Usage: "delete services and scheduled tasks managed by ecsceed which are removed from config",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:     "config",
+				Aliases:  []string{"c"},
+				Required: true,
+				Usage:    "specify config path",
+			},
+			&cli.BoolFlag{
+				Name:  "dry-run",
+				Usage: "dry run",
+			},
+			&cli.BoolFlag{
+				Name:    "yes",
+				Aliases: []string{"y"},
+				Usage:   "skip the confirmation",
+			},
+			&cli.DurationFlag{
+				Name:  "timeout",
+				Usage: "timeout for waiting services deleted",
+				Value: 10 * time.Minute,
+			},
+			&cli.DurationFlag{
+				Name:  "wait-for-lock",
+				Usage: "wait for the deploy lock of the other up to the duration",
+			},
+		},
+		Action: func(c *cli.Context) error {
+			config := c.String("config")
+			dryRun := c.Bool("dry-run")
+			yes := c.Bool("yes")
+			timeout := c.Duration("timeout")
+			waitForLock := c.Duration("wait-for-lock")
+
+			app, err := ecsceed.NewApp(config)
+			if err != nil {
+				return err
+			}
+
+			if len(os.Getenv("DEBUG")) > 0 {
+				app.Debug = true
+			}
+
+			return app.PruneServices(c.Context, ecsceed.PruneServicesOption{
+				DryRun:      dryRun,
+				Yes:         yes,
+				Timeout:     timeout,
+				WaitForLock: waitForLock,
+			})
+		},
+	}
+}
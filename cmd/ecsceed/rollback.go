@@ -2,6 +2,7 @@ package main
 
 import (
 	"os"
+	"time"
 
 	"github.com/maruware/ecsceed"
 
@@ -23,14 +24,36 @@ func rollbackCommand() *cli.Command {
 				Name:  "no-wait",
 				Usage: "no wait for services stable",
 			},
-			&cli.StringFlag{
+			&cli.BoolFlag{
 				Name:  "dry-run",
 				Usage: "dry run",
 			},
-			&cli.StringFlag{
+			&cli.BoolFlag{
 				Name:  "deregister",
 				Usage: "deregister task definition",
 			},
+			&cli.StringFlag{
+				Name:  "to",
+				Usage: "rollback target (revision, task definition arn, git sha or timestamp)",
+			},
+			&cli.DurationFlag{
+				Name:  "timeout",
+				Usage: "timeout for waiting services stable",
+				Value: 10 * time.Minute,
+			},
+			&cli.StringSliceFlag{
+				Name:    "service",
+				Aliases: []string{"s"},
+				Usage:   "target service name",
+			},
+			&cli.StringSliceFlag{
+				Name:  "exclude-service",
+				Usage: "excluded service name",
+			},
+			&cli.DurationFlag{
+				Name:  "wait-for-lock",
+				Usage: "wait for the deploy lock of the other up to the duration",
+			},
 		},
 		Action: func(c *cli.Context) error {
 			config := c.String("config")
@@ -38,6 +61,12 @@ func rollbackCommand() *cli.Command {
 			noWait := c.Bool("no-wait")
 			dryRun := c.Bool("dry-run")
 			deregister := c.Bool("deregister")
+			timeout := c.Duration("timeout")
+			to := c.String("to")
+
+			services := c.StringSlice("service")
+			excludeServices := c.StringSlice("exclude-service")
+			waitForLock := c.Duration("wait-for-lock")
 
 			app, err := ecsceed.NewApp(config)
 			if err != nil {
@@ -52,6 +81,11 @@ func rollbackCommand() *cli.Command {
 				NoWait:                   noWait,
 				DryRun:                   dryRun,
 				DeregisterTaskDefinition: deregister,
+				Timeout:                  timeout,
+				To:                       to,
+				Services:                 services,
+				ExcludeServices:          excludeServices,
+				WaitForLock:              waitForLock,
 			})
 			if err != nil {
 				return err
@@ -24,12 +24,24 @@ func statusCommand() *cli.Command {
 				Usage: "display events num",
 				Value: 3,
 			},
+			&cli.StringSliceFlag{
+				Name:    "service",
+				Aliases: []string{"s"},
+				Usage:   "target service name",
+			},
+			&cli.StringSliceFlag{
+				Name:  "exclude-service",
+				Usage: "excluded service name",
+			},
 		},
 		Action: func(c *cli.Context) error {
 			config := c.String("config")
 
 			events := c.Int("events")
 
+			services := c.StringSlice("service")
+			excludeServices := c.StringSlice("exclude-service")
+
 			app, err := ecsceed.NewApp(config)
 			if err != nil {
 				return err
@@ -40,7 +52,9 @@ func statusCommand() *cli.Command {
 			}
 
 			err = app.Status(c.Context, ecsceed.StatusOption{
-				Events: events,
+				Events:          events,
+				Services:        services,
+				ExcludeServices: excludeServices,
 			})
 			if err != nil {
 				return err
@@ -0,0 +1,243 @@
+package ecsceed
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/codedeploy"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/fatih/color"
+)
+
+var codeDeployPollInterval = 10 * time.Second
+
+type appSpec struct {
+	Version   string                       `json:"version"`
+	Resources []map[string]appSpecResource `json:"Resources"`
+}
+
+type appSpecResource struct {
+	Type       string            `json:"Type"`
+	Properties appSpecProperties `json:"Properties"`
+}
+
+type appSpecProperties struct {
+	TaskDefinition           string                            `json:"TaskDefinition"`
+	LoadBalancerInfo         appSpecLoadBalancerInfo           `json:"LoadBalancerInfo"`
+	PlatformVersion          *string                           `json:"PlatformVersion,omitempty"`
+	NetworkConfiguration     *appSpecNetworkConfiguration      `json:"NetworkConfiguration,omitempty"`
+	CapacityProviderStrategy []appSpecCapacityProviderStrategy `json:"CapacityProviderStrategy,omitempty"`
+}
+
+type appSpecLoadBalancerInfo struct {
+	ContainerName string `json:"ContainerName"`
+	ContainerPort int64  `json:"ContainerPort"`
+}
+
+type appSpecNetworkConfiguration struct {
+	AwsvpcConfiguration appSpecAwsvpcConfiguration `json:"AwsvpcConfiguration"`
+}
+
+type appSpecAwsvpcConfiguration struct {
+	Subnets        []string `json:"Subnets"`
+	SecurityGroups []string `json:"SecurityGroups,omitempty"`
+	AssignPublicIp *string  `json:"AssignPublicIp,omitempty"`
+}
+
+type appSpecCapacityProviderStrategy struct {
+	Base             int64  `json:"Base"`
+	CapacityProvider string `json:"CapacityProvider"`
+	Weight           int64  `json:"Weight"`
+}
+
+func isCodeDeployService(srv ecs.Service) bool {
+	return srv.DeploymentController != nil && equalString(srv.DeploymentController.Type, ecs.DeploymentControllerTypeCodeDeploy)
+}
+
+// buildAppSpec generates the AppSpec of the ECS service to deploy the task definition
+func buildAppSpec(tdArn string, srv ecs.Service) (string, error) {
+	if len(srv.LoadBalancers) == 0 {
+		return "", fmt.Errorf("loadBalancers is required for CodeDeploy")
+	}
+	lb := srv.LoadBalancers[0]
+
+	props := appSpecProperties{
+		TaskDefinition: tdArn,
+		LoadBalancerInfo: appSpecLoadBalancerInfo{
+			ContainerName: aws.StringValue(lb.ContainerName),
+			ContainerPort: aws.Int64Value(lb.ContainerPort),
+		},
+		PlatformVersion: srv.PlatformVersion,
+	}
+	if nc := srv.NetworkConfiguration; nc != nil && nc.AwsvpcConfiguration != nil {
+		props.NetworkConfiguration = &appSpecNetworkConfiguration{
+			AwsvpcConfiguration: appSpecAwsvpcConfiguration{
+				Subnets:        aws.StringValueSlice(nc.AwsvpcConfiguration.Subnets),
+				SecurityGroups: aws.StringValueSlice(nc.AwsvpcConfiguration.SecurityGroups),
+				AssignPublicIp: nc.AwsvpcConfiguration.AssignPublicIp,
+			},
+		}
+	}
+	for _, s := range srv.CapacityProviderStrategy {
+		props.CapacityProviderStrategy = append(props.CapacityProviderStrategy, appSpecCapacityProviderStrategy{
+			Base:             aws.Int64Value(s.Base),
+			CapacityProvider: aws.StringValue(s.CapacityProvider),
+			Weight:           aws.Int64Value(s.Weight),
+		})
+	}
+
+	spec := appSpec{
+		Version: "0.0",
+		Resources: []map[string]appSpecResource{
+			{
+				"TargetService": {
+					Type:       "AWS::ECS::Service",
+					Properties: props,
+				},
+			},
+		},
+	}
+	b, err := json.Marshal(spec)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// updateCodeDeployService deploys the task definition to the service by a CodeDeploy blue/green deployment
+func (a *App) updateCodeDeployService(ctx context.Context, opt DeployOption, name string, nameToTdArn map[string]string) error {
+	srv := a.def.nameToSrv[name]
+	fullname := a.resolveFullName(name)
+	cd := srv.codeDeploy
+
+	if opt.DryRun {
+		color.Green("~ service with CodeDeploy deployment: %s application=%s deployment group=%s", fullname, cd.Application, cd.DeploymentGroup)
+		return nil
+	}
+
+	tdArn, ok := nameToTdArn[srv.taskDefinition]
+	if !ok {
+		return fmt.Errorf("Bad reference service to task definition")
+	}
+
+	if opt.UpdateService {
+		// network configuration, capacity provider strategy and platform version are updated by the AppSpec
+		attrs := srv.srv
+		attrs.NetworkConfiguration = nil
+		attrs.CapacityProviderStrategy = nil
+		attrs.PlatformVersion = nil
+		if _, err := a.UpdateServiceAttributes(ctx, &attrs, fullname, nil); err != nil {
+			return err
+		}
+	}
+
+	spec, err := buildAppSpec(tdArn, srv.srv)
+	if err != nil {
+		return fmt.Errorf("service %s: %w", name, err)
+	}
+	a.DebugLog("AppSpec", spec)
+
+	in := &codedeploy.CreateDeploymentInput{
+		ApplicationName:     aws.String(cd.Application),
+		DeploymentGroupName: aws.String(cd.DeploymentGroup),
+		Description:         aws.String(fmt.Sprintf("ecsceed deploy %s", arnToName(tdArn))),
+		Revision: &codedeploy.RevisionLocation{
+			RevisionType: aws.String(codedeploy.RevisionLocationTypeAppSpecContent),
+			AppSpecContent: &codedeploy.AppSpecContent{
+				Content: aws.String(spec),
+			},
+		},
+	}
+	if cd.DeploymentConfig != "" {
+		in.DeploymentConfigName = aws.String(cd.DeploymentConfig)
+	}
+	out, err := a.codeDeploy.CreateDeploymentWithContext(ctx, in)
+	if err != nil {
+		return fmt.Errorf("failed to create CodeDeploy deployment: %w", err)
+	}
+	a.Log(LogDone(), "Created CodeDeploy deployment", LogTarget(*out.DeploymentId), "for", LogTarget(fullname))
+
+	if opt.NoWait {
+		return nil
+	}
+	return a.waitCodeDeployment(ctx, opt.Timeout, *out.DeploymentId, fullname)
+}
+
+// waitCodeDeployment streams the status and lifecycle events of the deployment until it completes
+func (a *App) waitCodeDeployment(ctx context.Context, timeout time.Duration, id string, fullname string) error {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	targetID := fmt.Sprintf("%s:%s", arnToName(a.def.cluster), fullname)
+	var status string
+	events := map[string]string{}
+	for {
+		out, err := a.codeDeploy.GetDeploymentWithContext(ctx, &codedeploy.GetDeploymentInput{
+			DeploymentId: aws.String(id),
+		})
+		if err != nil {
+			if ctx.Err() == context.DeadlineExceeded {
+				return fmt.Errorf("timed out after %s waiting for CodeDeploy deployment %s", timeout, id)
+			}
+			return err
+		}
+		info := out.DeploymentInfo
+
+		target, err := a.codeDeploy.GetDeploymentTargetWithContext(ctx, &codedeploy.GetDeploymentTargetInput{
+			DeploymentId: aws.String(id),
+			TargetId:     aws.String(targetID),
+		})
+		if err != nil {
+			a.DebugLog("failed to get deployment target", err)
+		} else if target.DeploymentTarget != nil && target.DeploymentTarget.EcsTarget != nil {
+			for _, e := range target.DeploymentTarget.EcsTarget.LifecycleEvents {
+				name, s := aws.StringValue(e.LifecycleEventName), aws.StringValue(e.Status)
+				if events[name] != s {
+					events[name] = s
+					a.Log("lifecycle event", LogTarget(name), s)
+				}
+			}
+		}
+
+		if s := aws.StringValue(info.Status); s != status {
+			status = s
+			a.Log("CodeDeploy deployment", LogTarget(id), "is", status)
+		}
+
+		switch status {
+		case codedeploy.DeploymentStatusSucceeded:
+			a.Log(LogDone(), "CodeDeploy deployment succeeded", LogTarget(fullname))
+			return nil
+		case codedeploy.DeploymentStatusFailed, codedeploy.DeploymentStatusStopped:
+			msg := status
+			if info.ErrorInformation != nil {
+				msg = fmt.Sprintf("%s: %s", status, aws.StringValue(info.ErrorInformation.Message))
+			}
+			if info.RollbackInfo != nil && info.RollbackInfo.RollbackDeploymentId != nil {
+				msg = fmt.Sprintf("%s (rolled back by %s)", msg, *info.RollbackInfo.RollbackDeploymentId)
+			}
+			return fmt.Errorf("CodeDeploy deployment %s of %s %s", id, fullname, msg)
+		case codedeploy.DeploymentStatusReady:
+			// the deployment group waits for traffic rerouting to be approved
+			return fmt.Errorf(
+				"CodeDeploy deployment %s of %s is Ready and waits for traffic rerouting. continue it with `aws deploy continue-deployment --deployment-id %s` or stop it",
+				id, fullname, id,
+			)
+		}
+
+		select {
+		case <-ctx.Done():
+			if ctx.Err() == context.DeadlineExceeded {
+				return fmt.Errorf("timed out after %s waiting for CodeDeploy deployment %s", timeout, id)
+			}
+			return ctx.Err()
+		case <-time.After(codeDeployPollInterval):
+		}
+	}
+}
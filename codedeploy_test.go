@@ -0,0 +1,52 @@
+package ecsceed
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildAppSpec(t *testing.T) {
+	srv := ecs.Service{
+		LoadBalancers: []*ecs.LoadBalancer{
+			{ContainerName: aws.String("app"), ContainerPort: aws.Int64(80)},
+		},
+		PlatformVersion: aws.String("1.4.0"),
+		NetworkConfiguration: &ecs.NetworkConfiguration{
+			AwsvpcConfiguration: &ecs.AwsVpcConfiguration{
+				Subnets:        aws.StringSlice([]string{"subnet-1"}),
+				SecurityGroups: aws.StringSlice([]string{"sg-1"}),
+				AssignPublicIp: aws.String("DISABLED"),
+			},
+		},
+	}
+	spec, err := buildAppSpec("arn:aws:ecs:ap-northeast-1:123456789012:task-definition/api:3", srv)
+	assert.NoError(t, err)
+
+	expected := `{
+		"version": "0.0",
+		"Resources": [{
+			"TargetService": {
+				"Type": "AWS::ECS::Service",
+				"Properties": {
+					"TaskDefinition": "arn:aws:ecs:ap-northeast-1:123456789012:task-definition/api:3",
+					"LoadBalancerInfo": {"ContainerName": "app", "ContainerPort": 80},
+					"PlatformVersion": "1.4.0",
+					"NetworkConfiguration": {
+						"AwsvpcConfiguration": {"Subnets": ["subnet-1"], "SecurityGroups": ["sg-1"], "AssignPublicIp": "DISABLED"}
+					}
+				}
+			}
+		}]
+	}`
+	var got, want interface{}
+	assert.NoError(t, json.Unmarshal([]byte(spec), &got))
+	assert.NoError(t, json.Unmarshal([]byte(expected), &want))
+	assert.Equal(t, want, got)
+
+	_, err = buildAppSpec("api:3", ecs.Service{})
+	assert.Error(t, err)
+}
@@ -9,28 +9,184 @@ import (
 )
 
 type ConfigTaskDef struct {
-	Name     string `yaml:"name"`
-	BaseFile string `yaml:"base_file"`
-	File     string `yaml:"file"`
+	Name         string   `yaml:"name"`
+	BaseFile     string   `yaml:"base_file"`
+	File         string   `yaml:"file"`
+	IgnoreFields []string `yaml:"ignore_fields"`
 }
 
 type ConfigService struct {
-	Name           string `yaml:"name"`
-	File           string `yaml:"file"`
+	Name             string                  `yaml:"name"`
+	File             string                  `yaml:"file"`
+	TaskDefinition   string                  `yaml:"task_definition"`
+	DependsOn        []string                `yaml:"depends_on"`
+	CodeDeploy       *ConfigCodeDeploy       `yaml:"code_deploy"`
+	Canary           *ConfigCanary           `yaml:"canary"`
+	Verify           []ConfigVerify          `yaml:"verify"`
+	Alarms           []string                `yaml:"alarms"`
+	BakeTime         string                  `yaml:"bake_time"`
+	AutoScaling      *ConfigAutoScaling      `yaml:"autoscaling"`
+	IgnoreFields     []string                `yaml:"ignore_fields"`
+	ServiceDiscovery *ConfigServiceDiscovery `yaml:"service_discovery"`
+}
+
+// ConfigServiceDiscovery is the Cloud Map service registered by the tasks of a service
+type ConfigServiceDiscovery struct {
+	Namespace     string                             `yaml:"namespace"`
+	Name          string                             `yaml:"name"`
+	RecordType    string                             `yaml:"record_type"`
+	TTL           *int64                             `yaml:"ttl"`
+	RoutingPolicy string                             `yaml:"routing_policy"`
+	HealthCheck   *ConfigServiceDiscoveryHealthCheck `yaml:"health_check"`
+	ContainerName string                             `yaml:"container_name"`
+	ContainerPort *int64                             `yaml:"container_port"`
+}
+
+type ConfigServiceDiscoveryHealthCheck struct {
+	FailureThreshold int64 `yaml:"failure_threshold"`
+}
+
+// ConfigAutoScaling is the Application Auto Scaling target, policies and scheduled actions of a service
+type ConfigAutoScaling struct {
+	MinCapacity      *int64                  `yaml:"min_capacity"`
+	MaxCapacity      *int64                  `yaml:"max_capacity"`
+	TargetTracking   []ConfigTargetTracking  `yaml:"target_tracking"`
+	StepScaling      []ConfigStepScaling     `yaml:"step_scaling"`
+	ScheduledActions []ConfigScheduledAction `yaml:"scheduled_actions"`
+}
+
+type ConfigTargetTracking struct {
+	Name             string  `yaml:"name"`
+	PredefinedMetric string  `yaml:"predefined_metric"`
+	ResourceLabel    string  `yaml:"resource_label"`
+	TargetValue      float64 `yaml:"target_value"`
+	ScaleInCooldown  string  `yaml:"scale_in_cooldown"`
+	ScaleOutCooldown string  `yaml:"scale_out_cooldown"`
+	DisableScaleIn   bool    `yaml:"disable_scale_in"`
+}
+
+type ConfigStepScaling struct {
+	Name                   string                 `yaml:"name"`
+	AdjustmentType         string                 `yaml:"adjustment_type"`
+	MetricAggregationType  string                 `yaml:"metric_aggregation_type"`
+	Cooldown               string                 `yaml:"cooldown"`
+	MinAdjustmentMagnitude *int64                 `yaml:"min_adjustment_magnitude"`
+	Steps                  []ConfigStepAdjustment `yaml:"steps"`
+}
+
+type ConfigStepAdjustment struct {
+	LowerBound *float64 `yaml:"lower_bound"`
+	UpperBound *float64 `yaml:"upper_bound"`
+	Adjustment int64    `yaml:"adjustment"`
+}
+
+type ConfigScheduledAction struct {
+	Name        string `yaml:"name"`
+	Schedule    string `yaml:"schedule"`
+	Timezone    string `yaml:"timezone"`
+	MinCapacity *int64 `yaml:"min_capacity"`
+	MaxCapacity *int64 `yaml:"max_capacity"`
+}
+
+// ConfigVerify is an HTTP check run after the service is stable
+type ConfigVerify struct {
+	URL      string `yaml:"url"`
+	Status   int    `yaml:"status"`
+	Body     string `yaml:"body"`
+	Retries  *int   `yaml:"retries"`
+	Interval string `yaml:"interval"`
+	Timeout  string `yaml:"timeout"`
+}
+
+// ConfigCanary is the canary steps of a service with the EXTERNAL deployment controller
+type ConfigCanary struct {
+	Steps       []ConfigCanaryStep `yaml:"steps"`
+	AutoPromote bool               `yaml:"auto_promote"`
+}
+
+type ConfigCanaryStep struct {
+	Weight float64 `yaml:"weight"`
+	Pause  string  `yaml:"pause"`
+}
+
+// ConfigCodeDeploy is the CodeDeploy target of a service with the CODE_DEPLOY deployment controller
+type ConfigCodeDeploy struct {
+	Application      string `yaml:"application"`
+	DeploymentGroup  string `yaml:"deployment_group"`
+	DeploymentConfig string `yaml:"deployment_config"`
+}
+
+// ConfigScheduledTask is an ECS task run by an EventBridge rule on a schedule
+type ConfigScheduledTask struct {
+	Name                 string                      `yaml:"name"`
+	TaskDefinition       string                      `yaml:"task_definition"`
+	Schedule             string                      `yaml:"schedule"`
+	Description          string                      `yaml:"description"`
+	Disabled             bool                        `yaml:"disabled"`
+	Service              string                      `yaml:"service"`
+	LaunchType           string                      `yaml:"launch_type"`
+	PlatformVersion      string                      `yaml:"platform_version"`
+	NetworkConfiguration *ConfigNetworkConfiguration `yaml:"network_configuration"`
+	Count                *int64                      `yaml:"count"`
+	Group                string                      `yaml:"group"`
+	RoleARN              string                      `yaml:"role_arn"`
+	Overrides            string                      `yaml:"overrides"`
+}
+
+type ConfigNetworkConfiguration struct {
+	Subnets        []string `yaml:"subnets"`
+	SecurityGroups []string `yaml:"security_groups"`
+	AssignPublicIP string   `yaml:"assign_public_ip"`
+}
+
+type ConfigHook struct {
+	Service        string `yaml:"service"`
 	TaskDefinition string `yaml:"task_definition"`
+	Command        string `yaml:"command"`
+	Container      string `yaml:"container"`
+	Overrides      string `yaml:"overrides"`
+}
+
+type ConfigHooks struct {
+	PreDeploy  []ConfigHook `yaml:"pre_deploy"`
+	PostDeploy []ConfigHook `yaml:"post_deploy"`
+}
+
+type ConfigLocalHook struct {
+	Command       string `yaml:"command"`
+	Timeout       string `yaml:"timeout"`
+	IgnoreFailure bool   `yaml:"ignore_failure"`
+}
+
+type ConfigLocalHooks struct {
+	BeforeRender  []ConfigLocalHook `yaml:"before_render"`
+	AfterRegister []ConfigLocalHook `yaml:"after_register"`
+	AfterStable   []ConfigLocalHook `yaml:"after_stable"`
+	OnFailure     []ConfigLocalHook `yaml:"on_failure"`
+}
+
+type ConfigNotification struct {
+	Type   string   `yaml:"type"`
+	URL    string   `yaml:"url"`
+	Events []string `yaml:"events"`
 }
 
 type Config struct {
-	Region          string          `yaml:"region"`
-	Cluster         string          `yaml:"cluster"`
-	Params          Params          `yaml:"params"`
-	TaskDefinitions []ConfigTaskDef `yaml:"task_definitions"`
-	Services        []ConfigService `yaml:"services"`
-	Base            string          `yaml:"base"`
-	NamePrefix      string          `yaml:"name_prefix"`
-	NameSuffix      string          `yaml:"name_suffix"`
+	Region          string                `yaml:"region"`
+	Cluster         string                `yaml:"cluster"`
+	Params          Params                `yaml:"params"`
+	TaskDefinitions []ConfigTaskDef       `yaml:"task_definitions"`
+	Services        []ConfigService       `yaml:"services"`
+	ScheduledTasks  []ConfigScheduledTask `yaml:"scheduled_tasks"`
+	Base            string                `yaml:"base"`
+	NamePrefix      string                `yaml:"name_prefix"`
+	NameSuffix      string                `yaml:"name_suffix"`
+	Hooks           ConfigHooks           `yaml:"hooks"`
+	LocalHooks      ConfigLocalHooks      `yaml:"local_hooks"`
+	Notifications   []ConfigNotification  `yaml:"notifications"`
 
-	dir string
+	dir  string
+	path string
 }
 
 type ConfigStack []Config
@@ -53,6 +209,7 @@ func loadConfigStack(path string) (ConfigStack, error) {
 		}
 
 		c.dir = filepath.Dir(tmpPath)
+		c.path = tmpPath
 
 		// unshift
 		cs = append([]Config{c}, cs...)
@@ -3,6 +3,7 @@ package ecsceed
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"gopkg.in/yaml.v2"
@@ -36,3 +37,24 @@ func TestLoadConfigStack(t *testing.T) {
 		t.Errorf("failed to load config stack")
 	}
 }
+
+func TestParseHooks(t *testing.T) {
+	src := `
+hooks:
+  pre_deploy:
+    - service: API
+      command: /bin/api migrate
+      container: app
+`
+	var c Config
+	if err := parseConfig(strings.NewReader(src), &c); err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Hooks.PreDeploy) != 1 {
+		t.Fatalf("expect 1 pre_deploy hook but %d", len(c.Hooks.PreDeploy))
+	}
+	h := c.Hooks.PreDeploy[0]
+	if h.Service != "API" || h.Command != "/bin/api migrate" {
+		t.Errorf("bad pre_deploy hook %+v", h)
+	}
+}
@@ -5,6 +5,7 @@ import (
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go/service/ecs"
 )
 
 func (a *App) DescribeLogGroups(ctx context.Context, prefix string) ([]*cloudwatchlogs.LogGroup, error) {
@@ -19,10 +20,76 @@ func (a *App) DescribeLogGroups(ctx context.Context, prefix string) ([]*cloudwat
 	return out.LogGroups, nil
 }
 
-func (a *App) CreateLogGroup(ctx context.Context, name string) error {
-	_, err := a.cwl.CreateLogGroupWithContext(ctx, &cloudwatchlogs.CreateLogGroupInput{
+func (a *App) CreateLogGroup(ctx context.Context, name string, tags []*ecs.Tag) error {
+	in := &cloudwatchlogs.CreateLogGroupInput{
+		LogGroupName: aws.String(name),
+	}
+	if len(tags) > 0 {
+		in.Tags = map[string]*string{}
+		for _, t := range tags {
+			in.Tags[*t.Key] = t.Value
+		}
+	}
+	_, err := a.cwl.CreateLogGroupWithContext(ctx, in)
+
+	return err
+}
+
+// logGroupTags returns the tags of the log group in the form of ecs tags
+func (a *App) logGroupTags(ctx context.Context, name string) ([]*ecs.Tag, error) {
+	out, err := a.cwl.ListTagsLogGroupWithContext(ctx, &cloudwatchlogs.ListTagsLogGroupInput{
+		LogGroupName: aws.String(name),
+	})
+	if err != nil {
+		return nil, err
+	}
+	tags := []*ecs.Tag{}
+	for k, v := range out.Tags {
+		tags = append(tags, &ecs.Tag{Key: aws.String(k), Value: v})
+	}
+	return tags, nil
+}
+
+func (a *App) DeleteLogGroup(ctx context.Context, name string) error {
+	_, err := a.cwl.DeleteLogGroupWithContext(ctx, &cloudwatchlogs.DeleteLogGroupInput{
 		LogGroupName: aws.String(name),
 	})
 
 	return err
 }
+
+// existLogGroup reports whether the log group exists
+func (a *App) existLogGroup(ctx context.Context, name string) (bool, error) {
+	lgs, err := a.DescribeLogGroups(ctx, name)
+	if err != nil {
+		return false, err
+	}
+	for _, lg := range lgs {
+		if *lg.LogGroupName == name {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// logGroupsOf lists the awslogs groups of the task definitions
+func (a *App) logGroupsOf(tdNames []string) []string {
+	groups := []string{}
+	seen := map[string]bool{}
+	for _, name := range tdNames {
+		td := a.def.nameToTd[name]
+		for _, cd := range td.ContainerDefinitions {
+			lc := cd.LogConfiguration
+			if lc == nil || *lc.LogDriver != "awslogs" {
+				continue
+			}
+			group := lc.Options["awslogs-group"]
+			if group == nil || seen[*group] {
+				continue
+			}
+			seen[*group] = true
+			groups = append(groups, *group)
+		}
+	}
+	return groups
+}
@@ -1,47 +1,385 @@
 package ecsceed
 
 import (
+	"bufio"
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/applicationautoscaling"
 	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/aws/aws-sdk-go/service/servicediscovery"
 	"github.com/fatih/color"
+	"github.com/mattn/go-isatty"
 )
 
 type DeleteOption struct {
-	DryRun bool
+	DryRun                    bool
+	Services                  []string
+	ExcludeServices           []string
+	WaitForLock               time.Duration
+	Timeout                   time.Duration
+	DeregisterTaskDefinitions bool
+	DeleteLogGroups           bool
+	Yes                       bool
+}
+
+// deletePlan is the resources removed by delete
+type deletePlan struct {
+	services        []*ecs.Service
+	scalableTargets []*applicationautoscaling.ScalableTarget
+	scheduledTasks  []string
+	discoveries     []*servicediscovery.ServiceSummary
+	taskDefinitions []string
+	logGroups       []string
+}
+
+func (p deletePlan) empty() bool {
+	return len(p.services) == 0 && len(p.scalableTargets) == 0 && len(p.scheduledTasks) == 0 && len(p.discoveries) == 0 && len(p.taskDefinitions) == 0 && len(p.logGroups) == 0
+}
+
+func (p deletePlan) print() {
+	for _, s := range p.services {
+		color.Red("- service: %s (desired:%d running:%d)", *s.ServiceName, *s.DesiredCount, *s.RunningCount)
+	}
+	for _, t := range p.scalableTargets {
+		color.Red("- scalable target: %s (min:%d max:%d)", *t.ResourceId, *t.MinCapacity, *t.MaxCapacity)
+	}
+	for _, r := range p.scheduledTasks {
+		color.Red("- scheduled task: %s", r)
+	}
+	for _, d := range p.discoveries {
+		color.Red("- service discovery: %s (%s)", *d.Name, *d.Id)
+	}
+	for _, td := range p.taskDefinitions {
+		color.Red("- task definition: %s", arnToName(td))
+	}
+	for _, g := range p.logGroups {
+		color.Red("- CloudWatch Log Group: %s", g)
+	}
+}
+
+// confirm asks yes or no
+func confirm(in io.Reader, prompt string) bool {
+	fmt.Printf("%s [y/N]: ", prompt)
+	line, err := bufio.NewReader(in).ReadString('\n')
+	if err != nil && line == "" {
+		return false
+	}
+	switch strings.ToLower(strings.TrimSpace(line)) {
+	case "y", "yes":
+		return true
+	}
+	return false
+}
+
+// confirmOnTerminal asks yes or no on stdin, which must be a terminal
+func confirmOnTerminal(prompt string) (bool, error) {
+	if !isatty.IsTerminal(os.Stdin.Fd()) {
+		return false, errors.New("confirmation requires a terminal. use --yes to skip it")
+	}
+	return confirm(os.Stdin, prompt), nil
+}
+
+func (a *App) planDelete(ctx context.Context, opt DeleteOption, names []string) (deletePlan, error) {
+	plan := deletePlan{}
+
+	desc, err := a.DescribeServices(ctx, a.serviceFullNames(names))
+	if err != nil {
+		return plan, err
+	}
+	for _, s := range desc.Services {
+		if *s.Status != "ACTIVE" {
+			continue
+		}
+		plan.services = append(plan.services, s)
+
+		target, err := a.describeScalableTarget(ctx, *s.ServiceName)
+		if err != nil {
+			return plan, err
+		}
+		if target != nil {
+			plan.scalableTargets = append(plan.scalableTargets, target)
+		}
+	}
+
+	plan.discoveries, err = a.discoveryServicesOf(ctx, names)
+	if err != nil {
+		return plan, err
+	}
+
+	// scheduled tasks copying the settings of the selected services go with them
+	selected := len(opt.Services) > 0 || len(opt.ExcludeServices) > 0
+	deleted := map[string]bool{}
+	for _, name := range names {
+		deleted[name] = true
+	}
+	for _, name := range a.def.scheduledTaskNames {
+		if selected && !deleted[a.def.nameToScheduledTask[name].Service] {
+			continue
+		}
+		ruleName := a.resolveFullName(name)
+		def, err := a.describeScheduledTask(ctx, ruleName)
+		if err != nil {
+			return plan, err
+		}
+		if def != nil {
+			plan.scheduledTasks = append(plan.scheduledTasks, ruleName)
+		}
+	}
+
+	if !opt.DeregisterTaskDefinitions && !opt.DeleteLogGroups {
+		return plan, nil
+	}
+
+	// families shared with the other services are kept when services are selected
+	tdNames := a.def.tdNames
+	if selected {
+		tdNames, err = a.selectTaskDefinitions(names, nil)
+		if err != nil {
+			return plan, err
+		}
+		tdNames = a.unreferencedTaskDefinitions(tdNames, names)
+	}
+
+	if opt.DeregisterTaskDefinitions {
+		for _, name := range tdNames {
+			arns, err := a.ListTaskDefinitionRevisions(ctx, a.resolveFullName(name), ecs.TaskDefinitionStatusActive, 0)
+			if err != nil {
+				return plan, err
+			}
+			plan.taskDefinitions = append(plan.taskDefinitions, arns...)
+		}
+	}
+
+	if opt.DeleteLogGroups {
+		plan.logGroups, err = a.deletableLogGroups(ctx, tdNames)
+		if err != nil {
+			return plan, err
+		}
+	}
+
+	return plan, nil
+}
+
+// unsharedLogGroups lists the log groups of the task definitions not used by the other task definitions
+func (a *App) unsharedLogGroups(tdNames []string) []string {
+	deleted := map[string]bool{}
+	for _, name := range tdNames {
+		deleted[name] = true
+	}
+	kept := []string{}
+	for _, name := range a.def.tdNames {
+		if !deleted[name] {
+			kept = append(kept, name)
+		}
+	}
+	shared := map[string]bool{}
+	for _, g := range a.logGroupsOf(kept) {
+		shared[g] = true
+	}
+	groups := []string{}
+	for _, g := range a.logGroupsOf(tdNames) {
+		if !shared[g] {
+			groups = append(groups, g)
+		}
+	}
+	return groups
+}
+
+// deletableLogGroups lists the existing log groups of the task definitions created by the overlay
+func (a *App) deletableLogGroups(ctx context.Context, tdNames []string) ([]string, error) {
+	groups := []string{}
+	for _, g := range a.unsharedLogGroups(tdNames) {
+		exist, err := a.existLogGroup(ctx, g)
+		if err != nil {
+			return nil, err
+		}
+		if !exist {
+			continue
+		}
+		tags, err := a.logGroupTags(ctx, g)
+		if err != nil {
+			return nil, err
+		}
+		if !a.isManaged(tags) {
+			a.Log(color.YellowString("Skip log group not created by ecsceed:"), LogTarget(g))
+			continue
+		}
+		groups = append(groups, g)
+	}
+	return groups, nil
+}
+
+// unreferencedTaskDefinitions drops the task definitions referenced by services other than names and their scheduled tasks
+func (a *App) unreferencedTaskDefinitions(tdNames []string, names []string) []string {
+	deleted := map[string]bool{}
+	for _, name := range names {
+		deleted[name] = true
+	}
+	referenced := map[string]bool{}
+	for _, name := range a.def.srvNames {
+		if !deleted[name] {
+			referenced[a.def.nameToSrv[name].taskDefinition] = true
+		}
+	}
+	for _, name := range a.def.scheduledTaskNames {
+		st := a.def.nameToScheduledTask[name]
+		if !deleted[st.Service] {
+			referenced[st.TaskDefinition] = true
+		}
+	}
+
+	dst := []string{}
+	for _, name := range tdNames {
+		if !referenced[name] {
+			dst = append(dst, name)
+		}
+	}
+	return dst
 }
 
 func (a *App) Delete(ctx context.Context, opt DeleteOption) error {
+	if !opt.DryRun {
+		release, err := a.acquireLock(ctx, "delete", opt.WaitForLock)
+		if err != nil {
+			return err
+		}
+		defer release()
+	}
+
 	err := a.ResolveConfigStack(Params{})
 	if err != nil {
 		return err
 	}
-	srvNames := []*string{}
-	for name := range a.def.nameToSrv {
-		srvNames = append(srvNames, aws.String(a.resolveFullName(name)))
+	names, err := a.selectServices(opt.Services, opt.ExcludeServices)
+	if err != nil {
+		return err
 	}
-	a.Log(srvNames)
-	desc, err := a.DescribeServices(ctx, srvNames)
+
+	plan, err := a.planDelete(ctx, opt, names)
 	if err != nil {
 		return err
 	}
+	if plan.empty() {
+		a.Log("Nothing to delete")
+		return nil
+	}
 
-	for _, s := range desc.Services {
-		if opt.DryRun {
-			color.Red("- service: %s", *s.ServiceName)
-		} else {
-			input := &ecs.DeleteServiceInput{
-				Cluster: s.ClusterArn,
-				Service: s.ServiceName,
-			}
-			if _, err := a.ecs.DeleteServiceWithContext(ctx, input); err != nil {
-				return fmt.Errorf("Failed to delete service　%s: %w", LogTarget(*s.ServiceName), err)
+	plan.print()
+	if opt.DryRun {
+		return nil
+	}
+
+	if !opt.Yes {
+		ok, err := confirmOnTerminal("Are you sure to delete these resources?")
+		if err != nil {
+			return err
+		}
+		if !ok {
+			a.Log("Delete is canceled")
+			return nil
+		}
+	}
+
+	if opt.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opt.Timeout)
+		defer cancel()
+	}
+
+	// stop the schedules before the services
+	for _, r := range plan.scheduledTasks {
+		if err := a.deleteScheduledTask(ctx, r); err != nil {
+			return fmt.Errorf("failed to delete scheduled task %s: %w", r, err)
+		}
+		a.Log(LogDone(), "Deleted scheduled task", LogTarget(r))
+	}
+
+	// policies and scheduled actions could scale out the services while draining
+	for _, t := range plan.scalableTargets {
+		if err := a.deregisterScalableTarget(ctx, t); err != nil {
+			return fmt.Errorf("failed to deregister scalable target %s: %w", *t.ResourceId, err)
+		}
+		a.Log(LogDone(), "Deregistered scalable target", LogTarget(*t.ResourceId))
+	}
+
+	if err := a.deleteServices(ctx, plan.services); err != nil {
+		return err
+	}
+
+	// ECS deregisters the tasks from Cloud Map services asynchronously, and services with instances can't be deleted
+	for _, d := range plan.discoveries {
+		a.Log("Waiting for instances deregistered from service discovery", LogTarget(*d.Name))
+		if err := a.waitDiscoveryInstancesDeregistered(ctx, *d.Id); err != nil {
+			return fmt.Errorf("failed to wait for instances deregistered from service discovery %s: %w", *d.Name, err)
+		}
+		if err := a.DeleteDiscoveryService(ctx, *d.Id); err != nil {
+			return fmt.Errorf("failed to delete service discovery %s: %w", *d.Name, err)
+		}
+		a.Log(LogDone(), "Deleted service discovery", LogTarget(*d.Name))
+	}
+
+	for _, td := range plan.taskDefinitions {
+		if err := a.DeregisterTaskDefinition(ctx, td); err != nil {
+			return fmt.Errorf("failed to deregister task definition %s: %w", arnToName(td), err)
+		}
+		a.Log(LogDone(), "Deregistered", LogTarget(arnToName(td)))
+	}
+
+	for _, g := range plan.logGroups {
+		if err := a.DeleteLogGroup(ctx, g); err != nil {
+			return fmt.Errorf("failed to delete log group %s: %w", g, err)
+		}
+		a.Log(LogDone(), "Deleted log group", LogTarget(g))
+	}
+
+	a.Log("Delete Completed!")
+	return nil
+}
+
+// deleteServices scales in the services, waits for the tasks drained, deletes them and waits until inactive
+func (a *App) deleteServices(ctx context.Context, services []*ecs.Service) error {
+	if len(services) == 0 {
+		return nil
+	}
+
+	names := []*string{}
+	scaled := []*string{}
+	for _, s := range services {
+		names = append(names, s.ServiceName)
+		// daemon services can't be scaled and are drained by deletion
+		if equalString(s.SchedulingStrategy, ecs.SchedulingStrategyDaemon) {
+			continue
+		}
+		if *s.DesiredCount > 0 {
+			if err := a.ScaleService(ctx, *s.ServiceName, 0); err != nil {
+				return err
 			}
-			a.Log("Service is deleted")
 		}
+		scaled = append(scaled, s.ServiceName)
 	}
 
+	if len(scaled) > 0 {
+		if err := a.WaitServiceDrained(ctx, scaled); err != nil {
+			return fmt.Errorf("failed to wait for tasks drained: %w", err)
+		}
+	}
+
+	for _, s := range services {
+		if err := a.DeleteService(ctx, *s.ServiceName, a.def.cluster, true); err != nil {
+			return fmt.Errorf("Failed to delete service %s: %w", LogTarget(*s.ServiceName), err)
+		}
+	}
+
+	if err := a.WaitServiceInactive(ctx, names); err != nil {
+		return fmt.Errorf("failed to wait for services inactive: %w", err)
+	}
+	a.Log(LogDone(), "Deleted services", LogTarget(strings.Join(aws.StringValueSlice(names), ", ")))
 	return nil
 }
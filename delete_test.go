@@ -0,0 +1,63 @@
+package ecsceed
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfirm(t *testing.T) {
+	assert.True(t, confirm(strings.NewReader("y\n"), "delete?"))
+	assert.True(t, confirm(strings.NewReader("Yes\n"), "delete?"))
+	assert.False(t, confirm(strings.NewReader("n\n"), "delete?"))
+	assert.False(t, confirm(strings.NewReader("\n"), "delete?"))
+	assert.False(t, confirm(strings.NewReader(""), "delete?"))
+}
+
+func TestUnreferencedTaskDefinitions(t *testing.T) {
+	app := &App{
+		def: Definition{
+			nameToSrv: map[string]Service{
+				"api":    {taskDefinition: "app"},
+				"worker": {taskDefinition: "app"},
+				"batch":  {taskDefinition: "batch"},
+			},
+			srvNames: []string{"api", "worker", "batch"},
+		},
+	}
+	assert.Equal(t, []string{"batch"}, app.unreferencedTaskDefinitions([]string{"app", "batch"}, []string{"api", "batch"}))
+	assert.Equal(t, []string{"app", "batch"}, app.unreferencedTaskDefinitions([]string{"app", "batch"}, []string{"api", "worker", "batch"}))
+
+	// scheduled tasks of the other services keep their task definitions
+	app.def.nameToScheduledTask = map[string]ConfigScheduledTask{
+		"report": {TaskDefinition: "batch", Service: "api"},
+	}
+	app.def.scheduledTaskNames = []string{"report"}
+	assert.Equal(t, []string{}, app.unreferencedTaskDefinitions([]string{"app", "batch"}, []string{"worker", "batch"}))
+	assert.Equal(t, []string{"app", "batch"}, app.unreferencedTaskDefinitions([]string{"app", "batch"}, []string{"api", "worker", "batch"}))
+}
+
+func TestUnsharedLogGroups(t *testing.T) {
+	awslogs := func(group string) *ecs.ContainerDefinition {
+		return &ecs.ContainerDefinition{
+			LogConfiguration: &ecs.LogConfiguration{
+				LogDriver: aws.String("awslogs"),
+				Options:   map[string]*string{"awslogs-group": aws.String(group)},
+			},
+		}
+	}
+	app := &App{
+		def: Definition{
+			nameToTd: map[string]ecs.TaskDefinition{
+				"api":    {ContainerDefinitions: []*ecs.ContainerDefinition{awslogs("/ecs/app"), awslogs("/ecs/api")}},
+				"worker": {ContainerDefinitions: []*ecs.ContainerDefinition{awslogs("/ecs/app")}},
+			},
+			tdNames: []string{"api", "worker"},
+		},
+	}
+	assert.Equal(t, []string{"/ecs/api"}, app.unsharedLogGroups([]string{"api"}))
+	assert.Equal(t, []string{"/ecs/app", "/ecs/api"}, app.unsharedLogGroups([]string{"api", "worker"}))
+}
@@ -0,0 +1,96 @@
+package ecsceed
+
+import (
+	"fmt"
+	"strings"
+)
+
+// serviceStages groups services into stages by depends_on.
+// Services in a stage depend only on services in the former stages.
+// Dependencies which are not in names are ignored.
+func (a *App) serviceStages(names []string) ([][]string, error) {
+	selected := map[string]bool{}
+	for _, name := range names {
+		selected[name] = true
+	}
+
+	done := map[string]bool{}
+	stages := [][]string{}
+	for len(done) < len(names) {
+		stage := []string{}
+		for _, name := range names {
+			if done[name] {
+				continue
+			}
+			ready := true
+			for _, dep := range a.def.nameToSrv[name].dependsOn {
+				if selected[dep] && !done[dep] {
+					ready = false
+					break
+				}
+			}
+			if ready {
+				stage = append(stage, name)
+			}
+		}
+		if len(stage) == 0 {
+			return nil, fmt.Errorf("circular dependency in services: %s", strings.Join(a.findDependencyCycle(names, done), " -> "))
+		}
+		for _, name := range stage {
+			done[name] = true
+		}
+		stages = append(stages, stage)
+	}
+	return stages, nil
+}
+
+func (a *App) findDependencyCycle(names []string, done map[string]bool) []string {
+	selected := map[string]bool{}
+	for _, name := range names {
+		if !done[name] {
+			selected[name] = true
+		}
+	}
+
+	visiting := map[string]bool{}
+	visited := map[string]bool{}
+	path := []string{}
+
+	var visit func(name string) []string
+	visit = func(name string) []string {
+		if visiting[name] {
+			for i, n := range path {
+				if n == name {
+					return append(append([]string{}, path[i:]...), name)
+				}
+			}
+		}
+		if visited[name] {
+			return nil
+		}
+		visiting[name] = true
+		path = append(path, name)
+		for _, dep := range a.def.nameToSrv[name].dependsOn {
+			if !selected[dep] {
+				continue
+			}
+			if cycle := visit(dep); cycle != nil {
+				return cycle
+			}
+		}
+		path = path[:len(path)-1]
+		visiting[name] = false
+		visited[name] = true
+		return nil
+	}
+
+	for _, name := range names {
+		if !selected[name] {
+			continue
+		}
+		if cycle := visit(name); cycle != nil {
+			return cycle
+		}
+	}
+	return nil
+}
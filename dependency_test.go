@@ -0,0 +1,47 @@
+package ecsceed
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServiceStages(t *testing.T) {
+	app := &App{
+		def: Definition{
+			nameToSrv: map[string]Service{
+				"migrator": {},
+				"backend":  {},
+				"api":      {dependsOn: []string{"migrator", "backend"}},
+				"worker":   {dependsOn: []string{"migrator"}},
+			},
+		},
+	}
+
+	stages, err := app.serviceStages([]string{"api", "worker", "migrator", "backend"})
+	assert.NoError(t, err)
+	assert.Equal(t, [][]string{{"migrator", "backend"}, {"api", "worker"}}, stages)
+
+	// dependencies out of the targets are ignored
+	stages, err = app.serviceStages([]string{"api"})
+	assert.NoError(t, err)
+	assert.Equal(t, [][]string{{"api"}}, stages)
+}
+
+func TestServiceStagesCycle(t *testing.T) {
+	app := &App{
+		def: Definition{
+			nameToSrv: map[string]Service{
+				"a": {dependsOn: []string{"b"}},
+				"b": {dependsOn: []string{"c"}},
+				"c": {dependsOn: []string{"a"}},
+				"d": {},
+			},
+		},
+	}
+
+	_, err := app.serviceStages([]string{"d", "a", "b", "c"})
+	if assert.Error(t, err) {
+		assert.Equal(t, "circular dependency in services: a -> b -> c -> a", err.Error())
+	}
+}
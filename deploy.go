@@ -3,6 +3,10 @@ package ecsceed
 import (
 	"context"
 	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
@@ -12,45 +16,53 @@ import (
 )
 
 type DeployOption struct {
-	UpdateService      bool
-	ForceNewDeployment bool
-	AutoLogGroup       bool
-	AdditionalParams   Params
-	NoWait             bool
-	DryRun             bool
+	UpdateService             bool
+	ForceNewDeployment        bool
+	AutoLogGroup              bool
+	AdditionalParams          Params
+	NoWait                    bool
+	DryRun                    bool
+	RecreateOnImmutableChange bool
+	Timeout                   time.Duration
+	FailureThreshold          int
+	AutoRollback              bool
+	GitSHA                    string
+	GitBranch                 string
+	Services                  []string
+	ExcludeServices           []string
+	TaskDefinitions           []string
+	Parallel                  int
+	WaitForLock               time.Duration
+	Prune                     bool
+	Force                     bool
+
+	// metadata tags recorded on task definitions and services
+	tags []*ecs.Tag
+	// tags of services including the managed ones
+	serviceTags []*ecs.Tag
 }
 
-func (a *App) createLogGroupIfNotExist(ctx context.Context, opt DeployOption) error {
-	groups := map[string]struct{}{}
-
-	for _, td := range a.def.nameToTd {
-		for _, cd := range td.ContainerDefinitions {
-			lc := cd.LogConfiguration
-			if lc != nil && *lc.LogDriver == "awslogs" {
-				group := lc.Options["awslogs-group"]
-				groups[*group] = struct{}{}
-			}
-		}
+func (opt DeployOption) waitOption() WaitOption {
+	return WaitOption{
+		Timeout:          opt.Timeout,
+		FailureThreshold: opt.FailureThreshold,
 	}
+}
+
+// suffix of the temporary service used while recreating a service
+var recreateServiceSuffix = "-recreating"
 
-	for g := range groups {
-		lgs, err := a.DescribeLogGroups(ctx, g)
+func (a *App) createLogGroupIfNotExist(ctx context.Context, opt DeployOption, tdNames []string) error {
+	for _, g := range a.logGroupsOf(tdNames) {
+		isExist, err := a.existLogGroup(ctx, g)
 		if err != nil {
 			return err
 		}
-
-		isExist := false
-		for _, lg := range lgs {
-			if *lg.LogGroupName == g {
-				isExist = true
-				break
-			}
-		}
 		if !isExist {
 			if opt.DryRun {
 				color.Green("+ CloudWatch Log Group: %s", g)
 			} else {
-				if err := a.CreateLogGroup(ctx, g); err != nil {
+				if err := a.CreateLogGroup(ctx, g, opt.serviceTags); err != nil {
 					return err
 				}
 				a.Log(LogDone(), "Created log group", LogTarget(g))
@@ -76,6 +88,10 @@ func (a *App) createServiceIfNotExist(ctx context.Context, opt DeployOption, srv
 		srv := a.def.nameToSrv[name]
 		srvDef := srv.srv
 		srvDef.ServiceName = aws.String(fullname)
+		srvDef.DesiredCount, err = a.createDesiredCount(ctx, fullname, srv)
+		if err != nil {
+			return err
+		}
 
 		if opt.DryRun {
 			color.Yellow("+ service: %s", fullname)
@@ -86,6 +102,7 @@ func (a *App) createServiceIfNotExist(ctx context.Context, opt DeployOption, srv
 				return fmt.Errorf("Bad reference service to task definition: %s %s", name, srv.taskDefinition)
 			}
 
+			srvDef.Tags = mergeTags(srvDef.Tags, opt.serviceTags)
 			err := a.CreateService(ctx, a.def.cluster, tdArn, srvDef)
 			if err != nil {
 				return err
@@ -102,6 +119,10 @@ func (a *App) createServiceIfNotExist(ctx context.Context, opt DeployOption, srv
 			srv := a.def.nameToSrv[name]
 			srvDef := srv.srv
 			srvDef.ServiceName = aws.String(fullname)
+			srvDef.DesiredCount, err = a.createDesiredCount(ctx, fullname, srv)
+			if err != nil {
+				return err
+			}
 
 			if opt.DryRun {
 				color.Red("- service: %s", fullname)
@@ -119,6 +140,7 @@ func (a *App) createServiceIfNotExist(ctx context.Context, opt DeployOption, srv
 					return err
 				}
 
+				srvDef.Tags = mergeTags(srvDef.Tags, opt.serviceTags)
 				err = a.CreateService(ctx, a.def.cluster, tdArn, srvDef)
 				if err != nil {
 					return err
@@ -129,48 +151,331 @@ func (a *App) createServiceIfNotExist(ctx context.Context, opt DeployOption, srv
 	return nil
 }
 
-func (a *App) updateService(ctx context.Context, opt DeployOption, nameToTdArn map[string]string) error {
-	for name, srv := range a.def.nameToSrv {
-		fullname := a.resolveFullName(name)
+func sortedServiceElements(v interface{}) string {
+	elems := []string{}
+	rv := reflect.ValueOf(v)
+	for i := 0; i < rv.Len(); i++ {
+		elems = append(elems, rv.Index(i).Interface().(fmt.Stringer).String())
+	}
+	sort.Strings(elems)
+	return strings.Join(elems, "\n")
+}
+
+// immutableServiceChanges returns fields which ECS can't update on an existing service
+func immutableServiceChanges(curr ecs.Service, next ecs.Service) []string {
+	changes := []string{}
+
+	if sortedServiceElements(curr.LoadBalancers) != sortedServiceElements(next.LoadBalancers) {
+		changes = append(changes, "loadBalancers")
+	}
+	if sortedServiceElements(curr.ServiceRegistries) != sortedServiceElements(next.ServiceRegistries) {
+		changes = append(changes, "serviceRegistries")
+	}
+	if next.LaunchType != nil && !equalString(curr.LaunchType, *next.LaunchType) {
+		changes = append(changes, "launchType")
+	}
+	currStrategy := aws.StringValue(curr.SchedulingStrategy)
+	if currStrategy == "" {
+		currStrategy = ecs.SchedulingStrategyReplica
+	}
+	nextStrategy := aws.StringValue(next.SchedulingStrategy)
+	if nextStrategy == "" {
+		nextStrategy = ecs.SchedulingStrategyReplica
+	}
+	if currStrategy != nextStrategy {
+		changes = append(changes, "schedulingStrategy")
+	}
+
+	return changes
+}
+
+func (a *App) detectImmutableChanges(ctx context.Context, opt DeployOption, srvNames []*string) (map[string][]string, error) {
+	desc, err := a.DescribeServices(ctx, srvNames)
+	if err != nil {
+		return nil, err
+	}
+
+	nameToChanges := map[string][]string{}
+	for _, d := range desc.Services {
+		if *d.Status == "INACTIVE" {
+			continue
+		}
+		name := a.resolveKeyName(*d.ServiceName)
+		srv := a.def.nameToSrv[name]
+		// task sets carry these fields for the EXTERNAL deployment controller
+		if isExternalService(srv.srv) {
+			continue
+		}
+
+		desired, err := ignoreServiceFields(*d, srv.srv, srv.ignoreFields)
+		if err != nil {
+			return nil, err
+		}
+		changes := immutableServiceChanges(*d, desired)
+		if len(changes) == 0 {
+			continue
+		}
+		nameToChanges[name] = changes
 
 		if opt.DryRun {
-			color.Green("~ service with task definition: %s", fullname)
-		} else {
-			tdArn, ok := nameToTdArn[srv.taskDefinition]
-			if !ok {
-				return fmt.Errorf("Bad reference service to task definition")
+			color.Red("! immutable fields changed: service=%s fields=%s", *d.ServiceName, strings.Join(changes, ","))
+		}
+	}
+
+	if len(nameToChanges) > 0 && !opt.RecreateOnImmutableChange {
+		msgs := []string{}
+		for name, changes := range nameToChanges {
+			msgs = append(msgs, fmt.Sprintf("%s (%s)", a.resolveFullName(name), strings.Join(changes, ", ")))
+		}
+		sort.Strings(msgs)
+		err := fmt.Errorf(
+			"ECS can't update immutable fields of an existing service: %s. Use --recreate-on-immutable-change to replace the service",
+			strings.Join(msgs, ", "),
+		)
+		if opt.DryRun {
+			a.Log(err)
+			return map[string][]string{}, nil
+		}
+		return nil, err
+	}
+
+	return nameToChanges, nil
+}
+
+// recreateService replaces a service whose immutable fields are changed.
+// A temporary service takes over the traffic while the service is recreated with the same name.
+func (a *App) recreateService(ctx context.Context, opt DeployOption, fullname string, srvDef ecs.Service, tdArn string) error {
+	curr, err := a.DescribeService(ctx, &fullname)
+	if err != nil {
+		return err
+	}
+	target, err := a.describeScalableTarget(ctx, fullname)
+	if err != nil {
+		return err
+	}
+	// the scalable target owns the live desired count
+	if target != nil || srvDef.DesiredCount == nil || *srvDef.DesiredCount < *curr.DesiredCount {
+		srvDef.DesiredCount = curr.DesiredCount
+	}
+	srvDef.Tags = mergeTags(srvDef.Tags, opt.serviceTags)
+
+	tmpName := fullname + recreateServiceSuffix
+	tmpDef := srvDef
+	tmpDef.ServiceName = aws.String(tmpName)
+
+	a.Log("Recreating service", LogTarget(fullname), "via", LogTarget(tmpName))
+
+	if err := a.CreateService(ctx, a.def.cluster, tdArn, tmpDef); err != nil {
+		return err
+	}
+	if err := a.WaitServiceStable(ctx, time.Now(), []*string{&tmpName}, opt.waitOption()); err != nil {
+		return err
+	}
+
+	if err := a.replaceService(ctx, fullname); err != nil {
+		return err
+	}
+	srvDef.ServiceName = aws.String(fullname)
+	if err := a.CreateService(ctx, a.def.cluster, tdArn, srvDef); err != nil {
+		return err
+	}
+	if err := a.WaitServiceStable(ctx, time.Now(), []*string{&fullname}, opt.waitOption()); err != nil {
+		return err
+	}
+
+	if err := a.replaceService(ctx, tmpName); err != nil {
+		return err
+	}
+
+	a.Log(LogDone(), "Recreated service", LogTarget(fullname))
+	return nil
+}
+
+// replaceService scales in the service and deletes it
+func (a *App) replaceService(ctx context.Context, fullname string) error {
+	if err := a.ScaleService(ctx, fullname, 0); err != nil {
+		return err
+	}
+	if err := a.DeleteService(ctx, fullname, a.def.cluster, true); err != nil {
+		return err
+	}
+	return a.WaitServiceInactive(ctx, []*string{&fullname})
+}
+
+func (a *App) updateService(ctx context.Context, opt DeployOption, names []string, nameToTdArn map[string]string, recreates map[string][]string) error {
+	if opt.Parallel <= 1 || opt.DryRun {
+		for _, name := range names {
+			if err := a.updateOneService(ctx, opt, name, nameToTdArn, recreates); err != nil {
+				return err
 			}
+		}
+		return nil
+	}
+
+	// update in parallel and aggregate errors in config order
+	errs := make([]error, len(names))
+	sem := make(chan struct{}, opt.Parallel)
+	var wg sync.WaitGroup
+	for i, name := range names {
+		wg.Add(1)
+		go func(i int, name string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			sa := a.withLogPrefix(fmt.Sprintf("[%s]", name))
+			errs[i] = sa.updateOneService(ctx, opt, name, nameToTdArn, recreates)
+		}(i, name)
+	}
+	wg.Wait()
+
+	msgs := []string{}
+	for i, err := range errs {
+		if err != nil {
+			msgs = append(msgs, fmt.Sprintf("%s: %s", names[i], err))
+		}
+	}
+	if len(msgs) > 0 {
+		return fmt.Errorf("failed to update %d services: %s", len(msgs), strings.Join(msgs, "; "))
+	}
+	return nil
+}
+
+// deployStage creates and updates the services in the stage, and waits for them stable, verified and baked.
+// The alarms of the services are watched during the stage and fail it when they go into ALARM.
+func (a *App) deployStage(ctx context.Context, opt DeployOption, stage []string, nameToTdArn map[string]string, recreates map[string][]string, wait bool) error {
+	var stopAlarms func() error
+	if !opt.DryRun {
+		var err error
+		ctx, stopAlarms, err = a.watchAlarms(ctx, a.serviceAlarms(stage), opt.Force)
+		if err != nil {
+			return err
+		}
+	}
+
+	err := a.deployStageServices(ctx, opt, stage, nameToTdArn, recreates, wait)
+	if stopAlarms != nil {
+		if alarmErr := stopAlarms(); alarmErr != nil {
+			return alarmErr
+		}
+	}
+	return err
+}
+
+func (a *App) deployStageServices(ctx context.Context, opt DeployOption, stage []string, nameToTdArn map[string]string, recreates map[string][]string, wait bool) error {
+	stageSrvNames := a.serviceFullNames(stage)
+
+	// create service if not exist
+	if err := a.createServiceIfNotExist(ctx, opt, stageSrvNames, nameToTdArn); err != nil {
+		return err
+	}
+
+	// update service
+	if err := a.updateService(ctx, opt, stage, nameToTdArn, recreates); err != nil {
+		return err
+	}
+
+	if err := a.applyAutoScaling(ctx, opt, stage); err != nil {
+		return err
+	}
+
+	if !wait {
+		return nil
+	}
+	if err := a.WaitServiceStable(ctx, time.Now(), a.serviceFullNames(a.rollingUpdateServices(stage)), opt.waitOption()); err != nil {
+		return err
+	}
+	if err := a.verifyServices(ctx, stage); err != nil {
+		return err
+	}
+	return a.bake(ctx, stage)
+}
+
+// rollingUpdateServices filters the services updated by the ECS deployment controller.
+// The others wait for their deployments by themselves.
+func (a *App) rollingUpdateServices(names []string) []string {
+	dst := []string{}
+	for _, name := range names {
+		srv := a.def.nameToSrv[name].srv
+		if !isCodeDeployService(srv) && !isExternalService(srv) {
+			dst = append(dst, name)
+		}
+	}
+	return dst
+}
+
+func (a *App) updateOneService(ctx context.Context, opt DeployOption, name string, nameToTdArn map[string]string, recreates map[string][]string) error {
+	srv := a.def.nameToSrv[name]
+	fullname := a.resolveFullName(name)
+
+	if _, ok := recreates[name]; ok {
+		if opt.DryRun {
+			color.Red("- service: %s", fullname)
+			color.Yellow("+ service: %s", fullname)
+			PrintJSON(srv.srv)
+			return nil
+		}
+
+		tdArn, ok := nameToTdArn[srv.taskDefinition]
+		if !ok {
+			return fmt.Errorf("Bad reference service to task definition")
+		}
+		return a.recreateService(ctx, opt, fullname, srv.srv, tdArn)
+	}
+
+	if isCodeDeployService(srv.srv) {
+		return a.updateCodeDeployService(ctx, opt, name, nameToTdArn)
+	}
+	if isExternalService(srv.srv) {
+		return a.updateCanaryService(ctx, opt, name, nameToTdArn)
+	}
+
+	if opt.DryRun {
+		color.Green("~ service with task definition: %s", fullname)
+	} else {
+		tdArn, ok := nameToTdArn[srv.taskDefinition]
+		if !ok {
+			return fmt.Errorf("Bad reference service to task definition")
+		}
+
+		err := a.UpdateServiceTask(ctx, fullname, tdArn, nil, &opt.ForceNewDeployment)
+		if err != nil {
+			return err
+		}
+
+		// services with the old arn format can not be tagged
+		if err := a.TagService(ctx, fullname, opt.serviceTags); err != nil {
+			a.Log(color.YellowString("failed to tag service %s: %s", fullname, err))
+		}
+	}
 
-			err := a.UpdateServiceTask(ctx, fullname, tdArn, nil, &opt.ForceNewDeployment)
+	if opt.UpdateService {
+		srvDef := srv.srv
+		if opt.DryRun || len(srv.ignoreFields) > 0 {
+			curr, err := a.DescribeService(ctx, &fullname)
+			if err != nil {
+				return err
+			}
+			srvDef, err = ignoreServiceFields(*curr, srv.srv, srv.ignoreFields)
 			if err != nil {
 				return err
 			}
-		}
 
-		if opt.UpdateService {
 			if opt.DryRun {
 				color.Green("~ service attributes: %s", fullname)
-				//TODO: diff
-
-				curr, err := a.DescribeService(ctx, &fullname)
-				if err != nil {
-					return err
-				}
-				d, err := diffService(*curr, srv.srv)
+				d, err := diffService(*curr, srvDef)
 				if err != nil {
 					return err
 				}
-
 				fmt.Println(d)
-
-				// PrintJSON(srv.srv)
-			} else {
-				_, err := a.UpdateServiceAttributes(ctx, &srv.srv, fullname, &opt.ForceNewDeployment)
-				if err != nil {
-					return err
-				}
+				return nil
 			}
 		}
+
+		_, err := a.UpdateServiceAttributes(ctx, &srvDef, fullname, &opt.ForceNewDeployment)
+		if err != nil {
+			return err
+		}
 	}
 	return nil
 }
@@ -219,18 +524,156 @@ func svToUpdateServiceInput(sv *ecs.Service) *ecs.UpdateServiceInput {
 	}
 }
 
+// deployState is the progress of deploy shared with notifications and failure hooks
+type deployState struct {
+	startedAt   time.Time
+	nameToTdArn map[string]string
+	services    []string
+	snapshots   []serviceSnapshot
+}
+
+func (a *App) deployRevisions(state *deployState) []NotificationRevision {
+	prev := map[string]string{}
+	for _, snap := range state.snapshots {
+		prev[snap.name] = arnToName(snap.taskDefinition)
+	}
+
+	revisions := []NotificationRevision{}
+	for _, name := range state.services {
+		tdArn, ok := state.nameToTdArn[a.def.nameToSrv[name].taskDefinition]
+		if !ok {
+			continue
+		}
+		fullname := a.resolveFullName(name)
+		revisions = append(revisions, NotificationRevision{
+			Service: fullname,
+			From:    prev[fullname],
+			To:      arnToName(tdArn),
+		})
+	}
+	return revisions
+}
+
 func (a *App) Deploy(ctx context.Context, opt DeployOption) error {
+	if !opt.DryRun {
+		release, err := a.acquireLock(ctx, "deploy", opt.WaitForLock)
+		if err != nil {
+			return err
+		}
+		defer release()
+	}
+
+	state := &deployState{
+		startedAt:   time.Now(),
+		nameToTdArn: map[string]string{},
+	}
+	err := a.deploy(ctx, opt, state)
+	if opt.DryRun {
+		return err
+	}
+
+	if err != nil && len(a.def.localHooks.OnFailure) > 0 {
+		env := append(a.localHookEnv(localHookOnFailure, state.nameToTdArn), "ECSCEED_ERROR="+err.Error())
+		if hookErr := a.runLocalHooks(cleanupContext(), localHookOnFailure, a.def.localHooks.OnFailure, false, env); hookErr != nil {
+			a.Log(color.RedString("%s", hookErr))
+		}
+	}
+
+	event := NotifyDeploySuccess
+	if err != nil {
+		event = NotifyDeployFailure
+	}
+	a.notify(Notification{
+		Event:     event,
+		Services:  a.serviceFullNameStrings(state.services),
+		Revisions: a.deployRevisions(state),
+		Duration:  time.Since(state.startedAt).Seconds(),
+		Error:     errorString(err),
+	})
+
+	return err
+}
+
+func (a *App) deploy(ctx context.Context, opt DeployOption, state *deployState) error {
+	nameToTdArn := state.nameToTdArn
+
+	if err := a.runLocalHooks(ctx, localHookBeforeRender, a.def.localHooks.BeforeRender, opt.DryRun, a.localHookEnv(localHookBeforeRender, nameToTdArn)); err != nil {
+		return err
+	}
+
 	err := a.ResolveConfigStack(opt.AdditionalParams)
 	if err != nil {
 		return err
 	}
 
-	nameToTdArn := map[string]string{}
+	names, err := a.selectServices(opt.Services, opt.ExcludeServices)
+	if err != nil {
+		return err
+	}
+	srvNames := a.serviceFullNames(names)
+	state.services = names
+
+	if !opt.DryRun {
+		a.notify(Notification{
+			Event:    NotifyDeployStart,
+			Services: a.serviceFullNameStrings(names),
+		})
+	}
+
+	var tdNames []string
+	if len(opt.Services) == 0 && len(opt.ExcludeServices) == 0 && len(opt.TaskDefinitions) == 0 {
+		tdNames = a.def.tdNames
+	} else {
+		tdNames, err = a.selectTaskDefinitions(names, opt.TaskDefinitions)
+		if err != nil {
+			return err
+		}
+	}
+
+	stages, err := a.serviceStages(names)
+	if err != nil {
+		return err
+	}
+
+	opt.tags = a.deployTags(opt)
+	opt.serviceTags = mergeTags(opt.tags, a.managedTags())
+
+	// check before any changes, the arns of Cloud Map services are needed to check the service registries
+	discoveries, err := a.resolveServiceDiscovery(ctx, opt, names)
+	if err != nil {
+		return err
+	}
+	recreates := map[string][]string{}
+	if len(srvNames) > 0 {
+		recreates, err = a.detectImmutableChanges(ctx, opt, srvNames)
+		if err != nil {
+			return err
+		}
+	}
+	if err := a.applyServiceDiscovery(ctx, opt, discoveries); err != nil {
+		return err
+	}
+
 	// register task def
-	for name, td := range a.def.nameToTd {
+	for _, name := range tdNames {
+		td := a.def.nameToTd[name]
 		fullname := a.resolveFullName(name)
 		td.SetFamily(fullname)
 
+		if ignore := a.def.tdIgnoreFields[name]; len(ignore) > 0 {
+			// a new family has no live fields
+			if prevArn, err := a.FindLastTaskDefinition(ctx, fullname); err == nil {
+				prevTd, err := a.DescribeTaskDefinition(ctx, prevArn)
+				if err != nil {
+					return err
+				}
+				td, err = ignoreTaskDefinitionFields(*prevTd, td, ignore)
+				if err != nil {
+					return err
+				}
+			}
+		}
+
 		if opt.DryRun {
 			//TODO: diff
 			prevArn, err := a.FindLastTaskDefinition(ctx, fullname)
@@ -250,7 +693,7 @@ func (a *App) Deploy(ctx context.Context, opt DeployOption) error {
 				fmt.Println(d)
 			}
 		} else {
-			newTd, err := a.RegisterTaskDefinition(ctx, &td)
+			newTd, err := a.RegisterTaskDefinition(ctx, &td, opt.tags)
 			if err != nil {
 				return err
 			}
@@ -261,32 +704,86 @@ func (a *App) Deploy(ctx context.Context, opt DeployOption) error {
 
 	// log group
 	if opt.AutoLogGroup {
-		if err := a.createLogGroupIfNotExist(ctx, opt); err != nil {
+		if err := a.createLogGroupIfNotExist(ctx, opt, tdNames); err != nil {
 			return err
 		}
 	}
 
-	if len(a.def.nameToSrv) > 0 {
-		// create service if not exist
-		srvNames := []*string{}
-		for name := range a.def.nameToSrv {
-			srvNames = append(srvNames, aws.String(a.resolveFullName(name)))
+	if err := a.runLocalHooks(ctx, localHookAfterRegister, a.def.localHooks.AfterRegister, opt.DryRun, a.localHookEnv(localHookAfterRegister, nameToTdArn)); err != nil {
+		return err
+	}
+
+	// pre deploy hooks abort before touching services
+	if err := a.runHooks(ctx, "pre_deploy", a.def.hooks.PreDeploy, opt, nameToTdArn); err != nil {
+		return err
+	}
+
+	if len(names) > 0 {
+		if !opt.DryRun {
+			state.snapshots, err = a.snapshotServices(ctx, srvNames)
+			if err != nil {
+				return err
+			}
+		}
+		failed := func(err error) error {
+			if opt.AutoRollback && !opt.DryRun {
+				return a.autoRollback(opt, state.snapshots, err)
+			}
+			return err
 		}
 
-		err = a.createServiceIfNotExist(ctx, opt, srvNames, nameToTdArn)
+		for i, stage := range stages {
+			if len(stages) > 1 {
+				a.Log(fmt.Sprintf("Stage %d/%d:", i+1, len(stages)), LogTarget(strings.Join(stage, ", ")))
+			}
+
+			// the following stages wait for the dependencies even if no wait
+			isLast := i == len(stages)-1
+			wait := !opt.DryRun && (!opt.NoWait || !isLast)
+			if err := a.deployStage(ctx, opt, stage, nameToTdArn, recreates, wait); err != nil {
+				return failed(err)
+			}
+			if wait && len(stages) > 1 {
+				a.Log(LogDone(), fmt.Sprintf("Stage %d/%d is stable", i+1, len(stages)))
+			}
+		}
+	}
+
+	if err := a.deployScheduledTasks(ctx, opt, tdNames, nameToTdArn); err != nil {
+		return err
+	}
+
+	if opt.NoWait && len(a.def.localHooks.AfterStable) > 0 {
+		a.Log("Skipped after_stable local hooks because of no wait")
+	} else if err := a.runLocalHooks(ctx, localHookAfterStable, a.def.localHooks.AfterStable, opt.DryRun, a.localHookEnv(localHookAfterStable, nameToTdArn)); err != nil {
+		return err
+	}
+
+	// post deploy hooks run after services are stable
+	if opt.NoWait && len(a.def.hooks.PostDeploy) > 0 {
+		a.Log("Skipped post_deploy hooks because of no wait")
+	} else if err := a.runHooks(ctx, "post_deploy", a.def.hooks.PostDeploy, opt, nameToTdArn); err != nil {
+		return err
+	}
+
+	if opt.Prune {
+		services, err := a.findPrunableServices(ctx)
 		if err != nil {
 			return err
 		}
-
-		// update service
-		err = a.updateService(ctx, opt, nameToTdArn)
+		scheduledTasks, err := a.findPrunableScheduledTasks(ctx)
 		if err != nil {
 			return err
 		}
-
-		if !opt.NoWait && !opt.DryRun {
-			now := time.Now()
-			if err := a.WaitServiceStable(ctx, now, srvNames); err != nil {
+		printPrunable(services, scheduledTasks, a.configHash())
+		if !opt.DryRun && (len(services) > 0 || len(scheduledTasks) > 0) {
+			pruneCtx := ctx
+			if opt.Timeout > 0 {
+				var cancel context.CancelFunc
+				pruneCtx, cancel = context.WithTimeout(ctx, opt.Timeout)
+				defer cancel()
+			}
+			if err := a.deletePrunable(pruneCtx, services, scheduledTasks); err != nil {
 				return err
 			}
 		}
@@ -0,0 +1,75 @@
+package ecsceed
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestImmutableServiceChanges(t *testing.T) {
+	curr := ecs.Service{
+		LaunchType: aws.String("EC2"),
+		LoadBalancers: []*ecs.LoadBalancer{
+			{
+				ContainerName:  aws.String("app"),
+				ContainerPort:  aws.Int64(8080),
+				TargetGroupArn: aws.String("tg-a"),
+			},
+		},
+		SchedulingStrategy: aws.String("REPLICA"),
+	}
+
+	same := ecs.Service{
+		LoadBalancers: []*ecs.LoadBalancer{
+			{
+				ContainerName:  aws.String("app"),
+				ContainerPort:  aws.Int64(8080),
+				TargetGroupArn: aws.String("tg-a"),
+			},
+		},
+		ServiceRegistries: []*ecs.ServiceRegistry{},
+	}
+	assert.Empty(t, immutableServiceChanges(curr, same))
+
+	changed := ecs.Service{
+		LaunchType: aws.String("FARGATE"),
+		LoadBalancers: []*ecs.LoadBalancer{
+			{
+				ContainerName:  aws.String("app"),
+				ContainerPort:  aws.Int64(8080),
+				TargetGroupArn: aws.String("tg-b"),
+			},
+		},
+		SchedulingStrategy: aws.String("DAEMON"),
+	}
+	assert.Equal(t, []string{"loadBalancers", "launchType", "schedulingStrategy"}, immutableServiceChanges(curr, changed))
+}
+
+func TestSelectServices(t *testing.T) {
+	path := filepath.Join("test_files", "example1", "overlays", "develop", "config.yml")
+	app, err := NewApp(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := app.ResolveConfigStack(Params{}); err != nil {
+		t.Fatal(err)
+	}
+
+	names, err := app.selectServices(nil, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"API", "Worker"}, names)
+
+	names, err = app.selectServices(nil, []string{"Worker"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"API"}, names)
+
+	_, err = app.selectServices([]string{"Unknown"}, nil)
+	assert.Error(t, err)
+
+	tdNames, err := app.selectTaskDefinitions([]string{"API"}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"API"}, tdNames)
+}
@@ -14,7 +14,6 @@ import (
 	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
 	"github.com/aws/aws-sdk-go/service/ecs"
 	"github.com/mattn/go-isatty"
-	"github.com/morikuni/aec"
 	"github.com/pkg/errors"
 )
 
@@ -30,6 +29,10 @@ func arnToName(s string) string {
 	return ns[len(ns)-1]
 }
 
+func taskDefinitionFamily(tdArn string) string {
+	return strings.Split(arnToName(tdArn), ":")[0]
+}
+
 func formatDeployment(d *ecs.Deployment) string {
 	return fmt.Sprintf(
 		"%8s %s desired:%d pending:%d running:%d",
@@ -246,11 +249,12 @@ func toNumberMemory(memory string) *string {
 	return &memory
 }
 
-func (a *App) RegisterTaskDefinition(ctx context.Context, td *ecs.TaskDefinition) (*ecs.TaskDefinition, error) {
-	out, err := a.ecs.RegisterTaskDefinitionWithContext(
-		ctx,
-		tdToRegisterTaskDefinitionInput(td),
-	)
+func (a *App) RegisterTaskDefinition(ctx context.Context, td *ecs.TaskDefinition, tags []*ecs.Tag) (*ecs.TaskDefinition, error) {
+	in := tdToRegisterTaskDefinitionInput(td)
+	if len(tags) > 0 {
+		in.Tags = tags
+	}
+	out, err := a.ecs.RegisterTaskDefinitionWithContext(ctx, in)
 	if err != nil {
 		return nil, err
 	}
@@ -304,11 +308,68 @@ func (a *App) UpdateServiceTask(ctx context.Context, name string, taskDefinition
 	return nil
 }
 
+// API limits of the number of items in a request
+const (
+	describeServicesLimit = 10
+	describeTasksLimit    = 100
+)
+
+func chunkStrings(ss []*string, size int) [][]*string {
+	chunks := [][]*string{}
+	for len(ss) > size {
+		chunks = append(chunks, ss[:size])
+		ss = ss[size:]
+	}
+	if len(ss) > 0 {
+		chunks = append(chunks, ss)
+	}
+	return chunks
+}
+
+// DescribeServices describes services in batches of the API limit
 func (a *App) DescribeServices(ctx context.Context, names []*string) (*ecs.DescribeServicesOutput, error) {
-	return a.ecs.DescribeServicesWithContext(ctx, &ecs.DescribeServicesInput{
-		Cluster:  aws.String(a.def.cluster),
-		Services: names,
-	})
+	return a.describeServices(ctx, names, nil)
+}
+
+// DescribeServicesWithTags describes services including their tags
+func (a *App) DescribeServicesWithTags(ctx context.Context, names []*string) (*ecs.DescribeServicesOutput, error) {
+	return a.describeServices(ctx, names, []*string{aws.String(ecs.ServiceFieldTags)})
+}
+
+func (a *App) describeServices(ctx context.Context, names []*string, include []*string) (*ecs.DescribeServicesOutput, error) {
+	desc := &ecs.DescribeServicesOutput{
+		Services: []*ecs.Service{},
+		Failures: []*ecs.Failure{},
+	}
+	for _, chunk := range chunkStrings(names, describeServicesLimit) {
+		out, err := a.ecs.DescribeServicesWithContext(ctx, &ecs.DescribeServicesInput{
+			Cluster:  aws.String(a.def.cluster),
+			Services: chunk,
+			Include:  include,
+		})
+		if err != nil {
+			return nil, err
+		}
+		desc.Services = append(desc.Services, out.Services...)
+		desc.Failures = append(desc.Failures, out.Failures...)
+	}
+	return desc, nil
+}
+
+// DescribeTasks describes tasks in batches of the API limit
+func (a *App) DescribeTasks(ctx context.Context, arns []*string) ([]*ecs.Task, error) {
+	tasks := []*ecs.Task{}
+	for _, chunk := range chunkStrings(arns, describeTasksLimit) {
+		out, err := a.ecs.DescribeTasksWithContext(ctx, &ecs.DescribeTasksInput{
+			Cluster: aws.String(a.def.cluster),
+			Tasks:   chunk,
+		})
+		if err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, out.Tasks...)
+	}
+	return tasks, nil
 }
 
 func (a *App) DescribeService(ctx context.Context, name *string) (*ecs.Service, error) {
@@ -322,6 +383,21 @@ func (a *App) DescribeService(ctx context.Context, name *string) (*ecs.Service,
 	return o.Services[0], nil
 }
 
+func (a *App) TagService(ctx context.Context, name string, tags []*ecs.Tag) error {
+	if len(tags) == 0 {
+		return nil
+	}
+	srv, err := a.DescribeService(ctx, &name)
+	if err != nil {
+		return err
+	}
+	_, err = a.ecs.TagResourceWithContext(ctx, &ecs.TagResourceInput{
+		ResourceArn: srv.ServiceArn,
+		Tags:        tags,
+	})
+	return err
+}
+
 func (a *App) CreateService(ctx context.Context, cluster string, tdArn string, srv ecs.Service) error {
 	a.Log("Starting create service", *srv.ServiceName)
 
@@ -346,6 +422,16 @@ func (a *App) CreateService(ctx context.Context, cluster string, tdArn string, s
 		Tags:                          srv.Tags,
 		TaskDefinition:                aws.String(tdArn),
 	}
+	if isExternalService(srv) {
+		// task sets carry them for the EXTERNAL deployment controller
+		createServiceInput.CapacityProviderStrategy = nil
+		createServiceInput.LaunchType = nil
+		createServiceInput.LoadBalancers = nil
+		createServiceInput.NetworkConfiguration = nil
+		createServiceInput.PlatformVersion = nil
+		createServiceInput.ServiceRegistries = nil
+		createServiceInput.TaskDefinition = nil
+	}
 	if _, err := a.ecs.CreateServiceWithContext(ctx, createServiceInput); err != nil {
 		return errors.Wrap(err, "Failed to create service")
 	}
@@ -372,6 +458,62 @@ func (a *App) DeleteService(ctx context.Context, name string, cluster string, fo
 	return nil
 }
 
+func (a *App) ScaleService(ctx context.Context, name string, count int64) error {
+	_, err := a.ecs.UpdateServiceWithContext(ctx, &ecs.UpdateServiceInput{
+		Service:      aws.String(name),
+		Cluster:      aws.String(a.def.cluster),
+		DesiredCount: aws.Int64(count),
+	})
+	if err != nil {
+		return fmt.Errorf("Failed to scale service: %w", err)
+	}
+	time.Sleep(delayForServiceChanged) // wait for service updated
+
+	a.Log(LogDone(), "Scaled service", LogTarget(name), "to", count)
+	return nil
+}
+
+// WaitServiceDrained waits until the services have no running and pending tasks
+func (a *App) WaitServiceDrained(ctx context.Context, names []*string) error {
+	a.Log("Waiting for tasks drained...")
+	for {
+		desc, err := a.DescribeServices(ctx, names)
+		if err != nil {
+			return err
+		}
+		remaining := 0
+		for _, s := range desc.Services {
+			remaining += int(*s.RunningCount + *s.PendingCount)
+		}
+		if remaining == 0 {
+			return nil
+		}
+		a.DebugLog("remaining tasks", remaining)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(waitServiceInterval):
+		}
+	}
+}
+
+func (a *App) WaitServiceInactive(ctx context.Context, names []*string) error {
+	a.Log("Waiting for service inactive...")
+	for _, chunk := range chunkStrings(names, describeServicesLimit) {
+		err := a.ecs.WaitUntilServicesInactiveWithContext(
+			ctx, &ecs.DescribeServicesInput{
+				Cluster:  aws.String(a.def.cluster),
+				Services: chunk,
+			},
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (a *App) DescribeServiceDeployments(ctx context.Context, startedAt time.Time, names []*string) (int, error) {
 	out, err := a.DescribeServices(ctx, names)
 	if err != nil {
@@ -400,46 +542,6 @@ func (a *App) DescribeServiceDeployments(ctx context.Context, startedAt time.Tim
 	return lines, nil
 }
 
-func (a *App) WaitServiceStable(ctx context.Context, startedAt time.Time, names []*string) error {
-	a.Log("Waiting for service stable...(it will take a few minutes)")
-	waitCtx, cancel := context.WithCancel(ctx)
-	defer cancel()
-
-	go func() {
-		tick := time.Tick(10 * time.Second)
-		var lines int
-		for {
-			select {
-			case <-waitCtx.Done():
-				return
-			case <-tick:
-				if isTerminal {
-					for i := 0; i < lines; i++ {
-						fmt.Print(aec.EraseLine(aec.EraseModes.All), aec.PreviousLine(1))
-					}
-				}
-				lines, _ = a.DescribeServiceDeployments(waitCtx, startedAt, names)
-			}
-		}
-	}()
-
-	// // Add an option WithWaiterDelay and request.WithWaiterMaxAttempts for a long timeout.
-	// // SDK Default is 10 min (MaxAttempts=40 * Delay=15sec) at now.
-	// // ref. https://github.com/aws/aws-sdk-go/blob/d57c8d96f72d9475194ccf18d2ba70ac294b0cb3/service/ecs/waiters.go#L82-L83
-	// // Explicitly set these options so not being affected by the default setting.
-	// const delay = 15 * time.Second
-	// attempts := int((a.config.Timeout / delay)) + 1
-	// if (a.config.Timeout % delay) > 0 {
-	// 	attempts++
-	// }
-	return a.ecs.WaitUntilServicesStableWithContext(
-		ctx, &ecs.DescribeServicesInput{
-			Cluster:  aws.String(a.def.cluster),
-			Services: names,
-		},
-	)
-}
-
 func (a *App) DescribeTaskDefinition(ctx context.Context, tdArn string) (*ecs.TaskDefinition, error) {
 	out, err := a.ecs.DescribeTaskDefinitionWithContext(ctx, &ecs.DescribeTaskDefinitionInput{
 		TaskDefinition: &tdArn,
@@ -450,6 +552,17 @@ func (a *App) DescribeTaskDefinition(ctx context.Context, tdArn string) (*ecs.Ta
 	return out.TaskDefinition, nil
 }
 
+func (a *App) DescribeTaskDefinitionWithTags(ctx context.Context, tdArn string) (*ecs.TaskDefinition, []*ecs.Tag, error) {
+	out, err := a.ecs.DescribeTaskDefinitionWithContext(ctx, &ecs.DescribeTaskDefinitionInput{
+		TaskDefinition: &tdArn,
+		Include:        []*string{aws.String(ecs.TaskDefinitionFieldTags)},
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return out.TaskDefinition, out.Tags, nil
+}
+
 func (a *App) RunTask(ctx context.Context, srv ecs.Service, tdArn string, count int64, ov *ecs.TaskOverride) (*ecs.Task, error) {
 	out, err := a.ecs.RunTaskWithContext(ctx, &ecs.RunTaskInput{
 		CapacityProviderStrategy: srv.CapacityProviderStrategy,
@@ -600,18 +713,34 @@ func (a *App) DescribeTaskStatus(ctx context.Context, task *ecs.Task, watchConta
 		return fmt.Errorf("Failed to describe task %s: %s", *f.Arn, *f.Reason)
 	}
 
+	return taskStatusError(out.Tasks[0], *watchContainer.Name)
+}
+
+// taskStatusError reports the failure of the stopped task by the watched container.
+// A container without the exit code has never run, e.g. image pull errors, so the task is failed by the stopped reason.
+func taskStatusError(task *ecs.Task, watchContainer string) error {
 	var container *ecs.Container
-	for _, c := range out.Tasks[0].Containers {
-		if *c.Name == *watchContainer.Name {
+	for _, c := range task.Containers {
+		if *c.Name == watchContainer {
 			container = c
 			break
 		}
 	}
 	if container == nil {
-		container = out.Tasks[0].Containers[0]
+		if len(task.Containers) == 0 {
+			return fmt.Errorf("Task stopped without containers, Stopped Reason: %s", aws.StringValue(task.StoppedReason))
+		}
+		container = task.Containers[0]
 	}
 
-	if container.ExitCode != nil && *container.ExitCode != 0 {
+	if container.ExitCode == nil {
+		msg := fmt.Sprintf("Container: %s, Exit Code: none, Stopped Reason: %s", *container.Name, aws.StringValue(task.StoppedReason))
+		if container.Reason != nil {
+			msg += ", Reason: " + *container.Reason
+		}
+		return errors.New(msg)
+	}
+	if *container.ExitCode != 0 {
 		msg := fmt.Sprintf("Container: %s, Exit Code: %s", *container.Name, strconv.FormatInt(*container.ExitCode, 10))
 		if container.Reason != nil {
 			msg += ", Reason: " + *container.Reason
@@ -664,6 +793,59 @@ func (a *App) FindRollbackTarget(ctx context.Context, tdArn string) (string, err
 	}
 }
 
+var errTaskDefinitionNotFound = errors.New("task definition is not found")
+
+// findTaskDefinitionLimit bounds the revisions described by FindTaskDefinition, one call each
+var findTaskDefinitionLimit = 100
+
+// FindTaskDefinition finds the newest revision of the family which matches, within the newest findTaskDefinitionLimit revisions
+func (a *App) FindTaskDefinition(ctx context.Context, family string, match func(td *ecs.TaskDefinition, tags []*ecs.Tag) bool) (string, error) {
+	var found string
+	var findErr error
+	scanned := 0
+	err := a.ecs.ListTaskDefinitionsPagesWithContext(ctx,
+		&ecs.ListTaskDefinitionsInput{
+			FamilyPrefix: aws.String(family),
+			MaxResults:   aws.Int64(100),
+			Sort:         aws.String("DESC"),
+		},
+		func(out *ecs.ListTaskDefinitionsOutput, lastPage bool) bool {
+			for _, t := range out.TaskDefinitionArns {
+				if taskDefinitionFamily(*t) != family {
+					continue
+				}
+				if scanned >= findTaskDefinitionLimit {
+					return false
+				}
+				scanned++
+				td, tags, err := a.DescribeTaskDefinitionWithTags(ctx, *t)
+				if err != nil {
+					findErr = err
+					return false
+				}
+				if match(td, tags) {
+					found = *t
+					return false
+				}
+			}
+			return true
+		},
+	)
+	if err != nil {
+		return "", errors.Wrap(err, "Failed to list taskdefinitions")
+	}
+	if findErr != nil {
+		return "", findErr
+	}
+	if found == "" {
+		if scanned >= findTaskDefinitionLimit {
+			return "", errors.Wrapf(errTaskDefinitionNotFound, "not in the newest %d revisions of %s", findTaskDefinitionLimit, family)
+		}
+		return "", errTaskDefinitionNotFound
+	}
+	return found, nil
+}
+
 func (a *App) FindLastTaskDefinition(ctx context.Context, tdName string) (string, error) {
 	family := strings.Split(tdName, ":")[0]
 	for {
@@ -722,15 +904,85 @@ func (a *App) ListServiceTasks(ctx context.Context, name string) ([]*ecs.Task, e
 		}
 	}
 
-	out, err := a.ecs.DescribeTasksWithContext(ctx, &ecs.DescribeTasksInput{
-		Cluster: aws.String(a.def.cluster),
-		Tasks:   tasks,
-	})
+	return a.DescribeTasks(ctx, tasks)
+}
+
+// ListClusterServices lists the arns of all services in the cluster
+func (a *App) ListClusterServices(ctx context.Context) ([]*string, error) {
+	arns := []*string{}
+	err := a.ecs.ListServicesPagesWithContext(ctx,
+		&ecs.ListServicesInput{
+			Cluster:    aws.String(a.def.cluster),
+			MaxResults: aws.Int64(100),
+		},
+		func(out *ecs.ListServicesOutput, lastPage bool) bool {
+			arns = append(arns, out.ServiceArns...)
+			return true
+		},
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list services")
+	}
+	return arns, nil
+}
+
+// ListClusterTasks lists all running tasks in the cluster
+func (a *App) ListClusterTasks(ctx context.Context) ([]*ecs.Task, error) {
+	arns := []*string{}
+	err := a.ecs.ListTasksPagesWithContext(ctx,
+		&ecs.ListTasksInput{
+			Cluster: aws.String(a.def.cluster),
+		},
+		func(out *ecs.ListTasksOutput, lastPage bool) bool {
+			arns = append(arns, out.TaskArns...)
+			return true
+		},
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list tasks")
+	}
+	return a.DescribeTasks(ctx, arns)
+}
+
+func (a *App) ListStoppedServiceTasks(ctx context.Context, name string, tdArn string, since time.Time) ([]*ecs.Task, error) {
+	var nextToken *string
+
+	tasks := []*string{}
+	for {
+		out, err := a.ecs.ListTasksWithContext(ctx, &ecs.ListTasksInput{
+			Cluster:       aws.String(a.def.cluster),
+			ServiceName:   aws.String(name),
+			DesiredStatus: aws.String(ecs.DesiredStatusStopped),
+			NextToken:     nextToken,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		tasks = append(tasks, out.TaskArns...)
+
+		if out.NextToken != nil {
+			nextToken = out.NextToken
+		} else {
+			break
+		}
+	}
+	described, err := a.DescribeTasks(ctx, tasks)
 	if err != nil {
 		return nil, err
 	}
 
-	return out.Tasks, nil
+	stopped := []*ecs.Task{}
+	for _, t := range described {
+		if *t.TaskDefinitionArn != tdArn || t.CreatedAt == nil || t.CreatedAt.Before(since) {
+			continue
+		}
+		if *t.LastStatus != ecs.DesiredStatusStopped {
+			continue
+		}
+		stopped = append(stopped, t)
+	}
+	return stopped, nil
 }
 
 func (a *App) DescribeContainerInstance(ctx context.Context, arn string) (*ecs.ContainerInstance, error) {
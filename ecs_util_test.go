@@ -0,0 +1,50 @@
+package ecsceed
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChunkStrings(t *testing.T) {
+	names := []*string{}
+	for i := 0; i < 14; i++ {
+		names = append(names, aws.String(fmt.Sprintf("service-%d", i)))
+	}
+
+	chunks := chunkStrings(names, describeServicesLimit)
+	assert.Len(t, chunks, 2)
+	assert.Len(t, chunks[0], 10)
+	assert.Len(t, chunks[1], 4)
+
+	assert.Len(t, chunkStrings(names[:10], describeServicesLimit), 1)
+	assert.Empty(t, chunkStrings([]*string{}, describeTasksLimit))
+}
+
+func TestTaskStatusError(t *testing.T) {
+	task := func(exitCode *int64) *ecs.Task {
+		return &ecs.Task{
+			StoppedReason: aws.String("Essential container in task exited"),
+			Containers: []*ecs.Container{
+				{Name: aws.String("sidecar"), ExitCode: aws.Int64(0)},
+				{Name: aws.String("app"), ExitCode: exitCode},
+			},
+		}
+	}
+	assert.NoError(t, taskStatusError(task(aws.Int64(0)), "app"))
+	assert.Error(t, taskStatusError(task(aws.Int64(1)), "app"))
+
+	// the container never ran
+	pullFailed := task(nil)
+	pullFailed.StoppedReason = aws.String("CannotPullContainerError: pull image manifest has been retried 5 time(s)")
+	err := taskStatusError(pullFailed, "app")
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "CannotPullContainerError")
+	}
+
+	noContainers := &ecs.Task{StoppedReason: aws.String("ResourceInitializationError: unable to pull secrets")}
+	assert.Error(t, taskStatusError(noContainers, "app"))
+}
@@ -1,40 +1,72 @@
 package ecsceed
 
 import (
+	"context"
+	"fmt"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/session"
 
 	"github.com/aws/aws-sdk-go/service/applicationautoscaling"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
 	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go/service/codedeploy"
 	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/aws/aws-sdk-go/service/eventbridge"
+	"github.com/aws/aws-sdk-go/service/servicediscovery"
 )
 
 type Service struct {
-	srv            ecs.Service
-	taskDefinition string
+	srv              ecs.Service
+	taskDefinition   string
+	dependsOn        []string
+	codeDeploy       *ConfigCodeDeploy
+	canary           *ConfigCanary
+	verify           []verifyCheck
+	alarms           []string
+	bakeTime         time.Duration
+	autoScaling      *ConfigAutoScaling
+	ignoreFields     []string
+	serviceDiscovery *ConfigServiceDiscovery
 }
 
 type Definition struct {
-	params     Params
-	nameToTd   map[string]ecs.TaskDefinition
-	nameToSrv  map[string]Service
-	region     string
-	cluster    string
-	namePrefix string
-	nameSuffix string
+	params    Params
+	nameToTd  map[string]ecs.TaskDefinition
+	nameToSrv map[string]Service
+	// ignore_fields of task definitions
+	tdIgnoreFields      map[string][]string
+	tdNames             []string // in config order
+	srvNames            []string // in config order
+	nameToScheduledTask map[string]ConfigScheduledTask
+	scheduledTaskNames  []string // in config order
+	hooks               ConfigHooks
+	localHooks          ConfigLocalHooks
+
+	notifications []ConfigNotification
+	region        string
+	cluster       string
+	namePrefix    string
+	nameSuffix    string
 }
 
 type App struct {
-	ecs         *ecs.ECS
-	cwl         *cloudwatchlogs.CloudWatchLogs
-	autoScaling *applicationautoscaling.ApplicationAutoScaling
-	cs          ConfigStack
+	ecs              *ecs.ECS
+	cwl              *cloudwatchlogs.CloudWatchLogs
+	autoScaling      *applicationautoscaling.ApplicationAutoScaling
+	codeDeploy       *codedeploy.CodeDeploy
+	events           *eventbridge.EventBridge
+	serviceDiscovery *servicediscovery.ServiceDiscovery
+	alarmClient      alarmStateClient
+	cs               ConfigStack
 
 	def Definition
 
+	logPrefix string
+
 	Debug bool
 }
 
@@ -61,6 +93,28 @@ func NewAppWithConfigStack(cs ConfigStack) *App {
 		if len(c.NameSuffix) > 0 {
 			def.nameSuffix = c.NameSuffix
 		}
+		// overlay hooks replace base hooks
+		if c.Hooks.PreDeploy != nil {
+			def.hooks.PreDeploy = c.Hooks.PreDeploy
+		}
+		if c.Hooks.PostDeploy != nil {
+			def.hooks.PostDeploy = c.Hooks.PostDeploy
+		}
+		if c.LocalHooks.BeforeRender != nil {
+			def.localHooks.BeforeRender = c.LocalHooks.BeforeRender
+		}
+		if c.LocalHooks.AfterRegister != nil {
+			def.localHooks.AfterRegister = c.LocalHooks.AfterRegister
+		}
+		if c.LocalHooks.AfterStable != nil {
+			def.localHooks.AfterStable = c.LocalHooks.AfterStable
+		}
+		if c.LocalHooks.OnFailure != nil {
+			def.localHooks.OnFailure = c.LocalHooks.OnFailure
+		}
+		if c.Notifications != nil {
+			def.notifications = c.Notifications
+		}
 	}
 
 	config := aws.NewConfig()
@@ -68,14 +122,23 @@ func NewAppWithConfigStack(cs ConfigStack) *App {
 	sess := session.New(config)
 
 	return &App{
-		ecs:         ecs.New(sess),
-		cwl:         cloudwatchlogs.New(sess),
-		autoScaling: applicationautoscaling.New(sess),
-		cs:          cs,
-		def:         def,
+		ecs:              ecs.New(sess),
+		cwl:              cloudwatchlogs.New(sess),
+		autoScaling:      applicationautoscaling.New(sess),
+		codeDeploy:       codedeploy.New(sess),
+		events:           eventbridge.New(sess),
+		serviceDiscovery: servicediscovery.New(sess),
+		alarmClient:      &cloudWatchAlarms{cw: cloudwatch.New(sess)},
+		cs:               cs,
+		def:              def,
 	}
 }
 
+// cleanupContext is for cleanups after failures, which must run even if the command context is canceled by interruption
+func cleanupContext() context.Context {
+	return context.Background()
+}
+
 func (a *App) Name() string {
 	return "ecsceed"
 }
@@ -122,8 +185,13 @@ func (a *App) ResolveConfigStack(additionalParams Params) error {
 	}
 
 	nameToTd := map[string]ecs.TaskDefinition{}
+	tdIgnoreFields := map[string][]string{}
+	tdNames := []string{}
 	for _, c := range a.cs {
 		for _, tdc := range c.TaskDefinitions {
+			if err := validateIgnoreFields(tdc.IgnoreFields); err != nil {
+				return fmt.Errorf("task definition %s: %w", tdc.Name, err)
+			}
 			var baseTd ecs.TaskDefinition
 
 			if len(tdc.BaseFile) > 0 {
@@ -175,13 +243,33 @@ func (a *App) ResolveConfigStack(additionalParams Params) error {
 
 			// overwrite overlay def
 			name := tdc.Name
+			if _, ok := nameToTd[name]; !ok {
+				tdNames = append(tdNames, name)
+			}
 			nameToTd[name] = td
+			tdIgnoreFields[name] = tdc.IgnoreFields
 		}
 	}
 
 	nameToSrv := map[string]Service{}
+	srvNames := []string{}
 	for _, c := range a.cs {
 		for _, sc := range c.Services {
+			checks, err := verifyChecks(sc.Verify)
+			if err != nil {
+				return fmt.Errorf("service %s: %w", sc.Name, err)
+			}
+			if err := validateIgnoreFields(sc.IgnoreFields); err != nil {
+				return fmt.Errorf("service %s: %w", sc.Name, err)
+			}
+			var bakeTime time.Duration
+			if sc.BakeTime != "" {
+				bakeTime, err = time.ParseDuration(sc.BakeTime)
+				if err != nil {
+					return fmt.Errorf("service %s: invalid bake_time %s: %w", sc.Name, sc.BakeTime, err)
+				}
+			}
+
 			var srv ecs.Service
 			path, err := filepath.Abs(filepath.Join(c.dir, sc.File))
 			if err != nil {
@@ -195,16 +283,77 @@ func (a *App) ResolveConfigStack(additionalParams Params) error {
 
 			// overwrite overlay def
 			name := sc.Name
+			if _, ok := nameToSrv[name]; !ok {
+				srvNames = append(srvNames, name)
+			}
 			nameToSrv[name] = Service{
-				srv:            srv,
-				taskDefinition: sc.TaskDefinition,
+				srv:              srv,
+				taskDefinition:   sc.TaskDefinition,
+				dependsOn:        sc.DependsOn,
+				codeDeploy:       sc.CodeDeploy,
+				canary:           sc.Canary,
+				verify:           checks,
+				alarms:           sc.Alarms,
+				bakeTime:         bakeTime,
+				autoScaling:      sc.AutoScaling,
+				ignoreFields:     sc.IgnoreFields,
+				serviceDiscovery: sc.ServiceDiscovery,
+			}
+		}
+	}
+
+	for _, name := range srvNames {
+		for _, dep := range nameToSrv[name].dependsOn {
+			if _, ok := nameToSrv[dep]; !ok {
+				return fmt.Errorf("service %s depends on undefined service %s", name, dep)
+			}
+		}
+		if srv := nameToSrv[name]; isCodeDeployService(srv.srv) && srv.codeDeploy == nil {
+			return fmt.Errorf("service %s uses the CODE_DEPLOY deployment controller but code_deploy is not configured", name)
+		}
+		if _, err := canarySteps(nameToSrv[name].canary); err != nil {
+			return fmt.Errorf("service %s: %w", name, err)
+		}
+		if err := validateAutoScaling(nameToSrv[name]); err != nil {
+			return fmt.Errorf("service %s: %w", name, err)
+		}
+		if err := validateServiceDiscovery(nameToSrv[name]); err != nil {
+			return fmt.Errorf("service %s: %w", name, err)
+		}
+	}
+
+	nameToScheduledTask := map[string]ConfigScheduledTask{}
+	scheduledTaskNames := []string{}
+	for _, c := range a.cs {
+		for _, st := range c.ScheduledTasks {
+			// overwrite overlay def
+			if _, ok := nameToScheduledTask[st.Name]; !ok {
+				scheduledTaskNames = append(scheduledTaskNames, st.Name)
 			}
+			nameToScheduledTask[st.Name] = st
+		}
+	}
+	for _, name := range scheduledTaskNames {
+		if err := validateScheduledTask(nameToScheduledTask[name], nameToTd, nameToSrv); err != nil {
+			return fmt.Errorf("scheduled task %s: %w", name, err)
 		}
 	}
 
 	a.def.params = params
 	a.def.nameToTd = nameToTd
 	a.def.nameToSrv = nameToSrv
+	a.def.tdIgnoreFields = tdIgnoreFields
+	a.def.nameToScheduledTask = nameToScheduledTask
+	a.def.scheduledTaskNames = scheduledTaskNames
+	a.def.tdNames = tdNames
+	a.def.srvNames = srvNames
+
+	if err := a.validateHooks(); err != nil {
+		return err
+	}
+	if err := validateNotifications(a.def.notifications); err != nil {
+		return err
+	}
 
 	return nil
 }
@@ -225,6 +374,85 @@ func (a *App) GetService(name string) Service {
 	return a.def.nameToSrv[name]
 }
 
+// selectServices resolves the target services in config.
+// All services are selected when services is empty.
+func (a *App) selectServices(services []string, excludes []string) ([]string, error) {
+	for _, name := range services {
+		if _, ok := a.def.nameToSrv[name]; !ok {
+			return nil, fmt.Errorf("service %s is undefined", name)
+		}
+	}
+	for _, name := range excludes {
+		if _, ok := a.def.nameToSrv[name]; !ok {
+			return nil, fmt.Errorf("service %s is undefined", name)
+		}
+	}
+
+	candidates := services
+	if len(candidates) == 0 {
+		candidates = a.def.srvNames
+	}
+
+	excluded := map[string]bool{}
+	for _, name := range excludes {
+		excluded[name] = true
+	}
+
+	names := []string{}
+	selected := map[string]bool{}
+	for _, name := range candidates {
+		if excluded[name] || selected[name] {
+			continue
+		}
+		selected[name] = true
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+// selectTaskDefinitions resolves the task definitions referenced by the services and the explicitly requested ones
+func (a *App) selectTaskDefinitions(srvNames []string, tdNames []string) ([]string, error) {
+	for _, name := range tdNames {
+		if _, ok := a.def.nameToTd[name]; !ok {
+			return nil, fmt.Errorf("task definition %s is undefined", name)
+		}
+	}
+
+	names := []string{}
+	selected := map[string]bool{}
+	for _, name := range srvNames {
+		td := a.def.nameToSrv[name].taskDefinition
+		if selected[td] {
+			continue
+		}
+		if _, ok := a.def.nameToTd[td]; !ok {
+			return nil, fmt.Errorf("Bad reference service to task definition: %s %s", name, td)
+		}
+		selected[td] = true
+		names = append(names, td)
+	}
+	for _, name := range tdNames {
+		if selected[name] {
+			continue
+		}
+		selected[name] = true
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+func (a *App) serviceFullNames(names []string) []*string {
+	fullnames := []*string{}
+	for _, name := range names {
+		fullnames = append(fullnames, aws.String(a.resolveFullName(name)))
+	}
+	return fullnames
+}
+
+func (a *App) serviceFullNameStrings(names []string) []string {
+	return aws.StringValueSlice(a.serviceFullNames(names))
+}
+
 func (a *App) resolveFullName(name string) string {
 	return a.def.namePrefix + name + a.def.nameSuffix
 }
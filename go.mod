@@ -3,7 +3,7 @@ module github.com/maruware/ecsceed
 go 1.14
 
 require (
-	github.com/aws/aws-sdk-go v1.33.8
+	github.com/aws/aws-sdk-go v1.38.0
 	github.com/fatih/color v1.9.0
 	github.com/imdario/mergo v0.3.10 // indirect
 	github.com/kylelemons/godebug v1.1.0
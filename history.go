@@ -0,0 +1,190 @@
+package ecsceed
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/fatih/color"
+	"github.com/pkg/errors"
+)
+
+type HistoryOption struct {
+	TaskDefinitions []string
+	Limit           int
+}
+
+const defaultHistoryLimit = 10
+
+// formatMetadata formats the deploy metadata tags of a task definition
+func formatMetadata(tags []*ecs.Tag) string {
+	fields := []string{}
+	for _, key := range metadataTagKeys {
+		if v := tagValue(tags, key); v != "" {
+			fields = append(fields, fmt.Sprintf("%s:%s", strings.TrimPrefix(key, "ecsceed:"), v))
+		}
+	}
+	return strings.Join(fields, " ")
+}
+
+func formatRevision(td *ecs.TaskDefinition, tags []*ecs.Tag) string {
+	registeredAt := "-"
+	if td.RegisteredAt != nil {
+		registeredAt = td.RegisteredAt.In(timezone).Format("2006/01/02 15:04:05")
+	}
+	line := fmt.Sprintf(
+		"%6d %s %8s",
+		aws.Int64Value(td.Revision),
+		registeredAt,
+		aws.StringValue(td.Status),
+	)
+	if m := formatMetadata(tags); m != "" {
+		line += " " + m
+	}
+	return line
+}
+
+// taskDefinitionRevision is the revision number in a task definition arn
+func taskDefinitionRevision(tdArn string) int {
+	name := arnToName(tdArn)
+	rev, _ := strconv.Atoi(name[strings.LastIndex(name, ":")+1:])
+	return rev
+}
+
+// selectFamilies resolves the task definition names in config. All are selected when names is empty.
+func (a *App) selectFamilies(names []string) ([]string, error) {
+	if len(names) == 0 {
+		return a.def.tdNames, nil
+	}
+	for _, name := range names {
+		if _, ok := a.def.nameToTd[name]; !ok {
+			return nil, fmt.Errorf("task definition %s is undefined", name)
+		}
+	}
+	return names, nil
+}
+
+// ListTaskDefinitionRevisions lists the newest revisions of the family in the status up to limit.
+// All revisions are listed when limit is 0.
+func (a *App) ListTaskDefinitionRevisions(ctx context.Context, family string, status string, limit int) ([]string, error) {
+	arns := []string{}
+	err := a.ecs.ListTaskDefinitionsPagesWithContext(ctx,
+		&ecs.ListTaskDefinitionsInput{
+			FamilyPrefix: aws.String(family),
+			Status:       aws.String(status),
+			MaxResults:   aws.Int64(100),
+			Sort:         aws.String("DESC"),
+		},
+		func(out *ecs.ListTaskDefinitionsOutput, lastPage bool) bool {
+			for _, t := range out.TaskDefinitionArns {
+				if taskDefinitionFamily(*t) != family {
+					continue
+				}
+				arns = append(arns, *t)
+				if limit > 0 && len(arns) >= limit {
+					return false
+				}
+			}
+			return true
+		},
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to list taskdefinitions")
+	}
+	return arns, nil
+}
+
+// listHistory lists the newest revisions of the family including inactive ones
+func (a *App) listHistory(ctx context.Context, family string, limit int) ([]string, error) {
+	arns := []string{}
+	for _, status := range []string{ecs.TaskDefinitionStatusActive, ecs.TaskDefinitionStatusInactive} {
+		s, err := a.ListTaskDefinitionRevisions(ctx, family, status, limit)
+		if err != nil {
+			return nil, err
+		}
+		arns = append(arns, s...)
+	}
+	sort.Slice(arns, func(i, j int) bool {
+		return taskDefinitionRevision(arns[i]) > taskDefinitionRevision(arns[j])
+	})
+	if len(arns) > limit {
+		arns = arns[:limit]
+	}
+	return arns, nil
+}
+
+func (a *App) History(ctx context.Context, opt HistoryOption) error {
+	err := a.ResolveConfigStack(Params{})
+	if err != nil {
+		return err
+	}
+
+	names, err := a.selectFamilies(opt.TaskDefinitions)
+	if err != nil {
+		return err
+	}
+
+	limit := opt.Limit
+	if limit <= 0 {
+		limit = defaultHistoryLimit
+	}
+
+	printSection := color.New(color.FgGreen, color.Bold)
+	for i, name := range names {
+		family := a.resolveFullName(name)
+		printSection.Println(">>", family)
+
+		arns, err := a.listHistory(ctx, family, limit)
+		if err != nil {
+			return err
+		}
+		for _, arn := range arns {
+			td, tags, err := a.DescribeTaskDefinitionWithTags(ctx, arn)
+			if err != nil {
+				return err
+			}
+			fmt.Println(spcIndent + formatRevision(td, tags))
+		}
+
+		if i != len(names)-1 {
+			fmt.Println()
+		}
+	}
+	return nil
+}
+
+// HistoryDiff prints the diff between two revisions of the family.
+// family accepts the task definition name in config or the family name.
+func (a *App) HistoryDiff(ctx context.Context, family string, revA string, revB string) error {
+	err := a.ResolveConfigStack(Params{})
+	if err != nil {
+		return err
+	}
+	if _, ok := a.def.nameToTd[family]; ok {
+		family = a.resolveFullName(family)
+	}
+
+	tds := []*ecs.TaskDefinition{}
+	for _, rev := range []string{revA, revB} {
+		if !revisionPattern.MatchString(rev) {
+			return fmt.Errorf("invalid revision %s", rev)
+		}
+		td, err := a.DescribeTaskDefinition(ctx, fmt.Sprintf("%s:%s", family, rev))
+		if err != nil {
+			return errors.Wrapf(err, "failed to describe %s:%s", family, rev)
+		}
+		tds = append(tds, td)
+	}
+
+	color.Green("~ task definition: %s:%s -> %s:%s", family, revA, family, revB)
+	d, err := diffTaskDefinition(*tds[0], *tds[1])
+	if err != nil {
+		return err
+	}
+	fmt.Println(d)
+	return nil
+}
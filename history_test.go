@@ -0,0 +1,27 @@
+package ecsceed
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTaskDefinitionRevision(t *testing.T) {
+	assert.Equal(t, 12, taskDefinitionRevision("arn:aws:ecs:ap-northeast-1:123456789012:task-definition/api-develop:12"))
+	assert.Equal(t, 3, taskDefinitionRevision("api-develop:3"))
+}
+
+func TestFormatRevision(t *testing.T) {
+	td := &ecs.TaskDefinition{
+		Revision: aws.Int64(12),
+		Status:   aws.String(ecs.TaskDefinitionStatusActive),
+	}
+	tags := []*ecs.Tag{
+		newTag(tagDeployedBy, "alice@host"),
+		newTag(tagGitSHA, "1a2b3c4"),
+		{Key: aws.String("team"), Value: aws.String("web")},
+	}
+	assert.Equal(t, "    12 -   ACTIVE git-sha:1a2b3c4 deployed-by:alice@host", formatRevision(td, tags))
+}
@@ -0,0 +1,95 @@
+package ecsceed
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/fatih/color"
+	"github.com/mattn/go-shellwords"
+)
+
+func (a *App) validateHooks() error {
+	hooks := append(append([]ConfigHook{}, a.def.hooks.PreDeploy...), a.def.hooks.PostDeploy...)
+	for _, h := range hooks {
+		if h.Service == "" && h.TaskDefinition == "" {
+			return fmt.Errorf("hook requires service or task_definition")
+		}
+		if h.Service != "" {
+			if _, ok := a.def.nameToSrv[h.Service]; !ok {
+				return fmt.Errorf("hook refers undefined service %s", h.Service)
+			}
+		}
+		if h.TaskDefinition != "" {
+			if _, ok := a.def.nameToTd[h.TaskDefinition]; !ok {
+				return fmt.Errorf("hook refers undefined task definition %s", h.TaskDefinition)
+			}
+		}
+	}
+	return nil
+}
+
+// runHooks runs hooks as one-off tasks with the task definitions registered in the deploy,
+// or the latest revisions of the ones not deployed.
+// The service of a hook gives the network and launch settings of the task.
+func (a *App) runHooks(ctx context.Context, phase string, hooks []ConfigHook, opt DeployOption, nameToTdArn map[string]string) error {
+	for i, h := range hooks {
+		label := fmt.Sprintf("%s hook #%d", phase, i+1)
+
+		tdName := h.TaskDefinition
+		var srv ecs.Service
+		if h.Service != "" {
+			s := a.def.nameToSrv[h.Service]
+			srv = s.srv
+			if tdName == "" {
+				tdName = s.taskDefinition
+			}
+		}
+		srv.ClusterArn = aws.String(a.def.cluster)
+
+		var command []string
+		if h.Command != "" {
+			var err error
+			command, err = shellwords.Parse(h.Command)
+			if err != nil {
+				return fmt.Errorf("%s: command parse error. %s", label, h.Command)
+			}
+		}
+
+		if opt.DryRun {
+			color.Cyan("> %s: task definition=%s command=%s", label, a.resolveFullName(tdName), h.Command)
+			continue
+		}
+
+		tdArn, ok := nameToTdArn[tdName]
+		if !ok {
+			// the task definition is not deployed in this run, e.g. excluded by --service
+			arns, err := a.ListTaskDefinitionRevisions(ctx, a.resolveFullName(tdName), ecs.TaskDefinitionStatusActive, 1)
+			if err != nil {
+				return fmt.Errorf("%s: %w", label, err)
+			}
+			if len(arns) == 0 {
+				return fmt.Errorf("%s: task definition %s is not deployed and has no registered revision", label, tdName)
+			}
+			tdArn = arns[0]
+			a.Log(label, "uses the latest revision because task definition", LogTarget(tdName), "is not deployed")
+		}
+		td := a.def.nameToTd[tdName]
+		container := containerOf(&td, &h.Container)
+		if container == nil {
+			return fmt.Errorf("%s: container %s is undefined", label, h.Container)
+		}
+
+		a.Log("Running", label, "with", LogTarget(arnToName(tdArn)))
+		ov, err := a.taskOverride(container, h.Overrides, command)
+		if err != nil {
+			return fmt.Errorf("%s: %w", label, err)
+		}
+		if err := a.runTaskAndWait(ctx, srv, tdArn, container, 1, ov, false); err != nil {
+			return fmt.Errorf("%s failed: %w", label, err)
+		}
+		a.Log(LogDone(), label, "completed")
+	}
+	return nil
+}
@@ -0,0 +1,149 @@
+package ecsceed
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/private/protocol/json/jsonutil"
+	"github.com/aws/aws-sdk-go/service/ecs"
+)
+
+// parseFieldPath parses a JSON path of ignore_fields like $.containerDefinitions[*].image.
+// Arrays are traversed element by element, so [*] is optional.
+func parseFieldPath(p string) ([]string, error) {
+	s := strings.TrimPrefix(strings.TrimPrefix(p, "$"), ".")
+	s = strings.ReplaceAll(s, "[*]", "")
+	if s == "" {
+		return nil, fmt.Errorf("invalid ignore field %q", p)
+	}
+	segs := strings.Split(s, ".")
+	for _, seg := range segs {
+		if seg == "" || strings.ContainsAny(seg, "[]*$") {
+			return nil, fmt.Errorf("invalid ignore field %q", p)
+		}
+	}
+	return segs, nil
+}
+
+func validateIgnoreFields(paths []string) error {
+	for _, p := range paths {
+		if _, err := parseFieldPath(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// liveElement finds the live element of an array for the desired one, by name if named, otherwise by index
+func liveElement(live []interface{}, desired interface{}, i int) interface{} {
+	if d, ok := desired.(map[string]interface{}); ok {
+		if name, ok := d["name"]; ok {
+			for _, l := range live {
+				if m, ok := l.(map[string]interface{}); ok && m["name"] == name {
+					return m
+				}
+			}
+			return nil
+		}
+	}
+	if i < len(live) {
+		return live[i]
+	}
+	return nil
+}
+
+// preserveField copies the live value at the path into the desired value, or removes it when it's not live.
+// Desired values without the live counterpart, like a new container, are kept.
+func preserveField(live interface{}, desired interface{}, path []string) {
+	switch d := desired.(type) {
+	case map[string]interface{}:
+		l, ok := live.(map[string]interface{})
+		if !ok {
+			return
+		}
+		key := path[0]
+		if len(path) == 1 {
+			if v, ok := l[key]; ok {
+				d[key] = v
+			} else {
+				delete(d, key)
+			}
+			return
+		}
+		if _, ok := d[key]; !ok {
+			if v, ok := l[key]; ok {
+				d[key] = v
+			}
+			return
+		}
+		preserveField(l[key], d[key], path[1:])
+	case []interface{}:
+		l, _ := live.([]interface{})
+		for i := range d {
+			preserveField(liveElement(l, d[i], i), d[i], path)
+		}
+	}
+}
+
+func toGenericJSON(v interface{}) (interface{}, error) {
+	b, err := jsonutil.BuildJSON(v)
+	if err != nil {
+		return nil, err
+	}
+	var g interface{}
+	if err := json.Unmarshal(b, &g); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+// withIgnoredFields decodes the desired value into dst keeping the live values at the ignored paths
+func withIgnoredFields(live interface{}, desired interface{}, paths []string, dst interface{}) error {
+	l, err := toGenericJSON(live)
+	if err != nil {
+		return err
+	}
+	d, err := toGenericJSON(desired)
+	if err != nil {
+		return err
+	}
+	for _, p := range paths {
+		path, err := parseFieldPath(p)
+		if err != nil {
+			return err
+		}
+		preserveField(l, d, path)
+	}
+
+	b, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+	return jsonutil.UnmarshalJSON(dst, bytes.NewReader(b))
+}
+
+// ignoreServiceFields returns the desired service whose ignored fields are the live ones
+func ignoreServiceFields(live ecs.Service, desired ecs.Service, paths []string) (ecs.Service, error) {
+	if len(paths) == 0 {
+		return desired, nil
+	}
+	var dst ecs.Service
+	if err := withIgnoredFields(&live, &desired, paths, &dst); err != nil {
+		return desired, fmt.Errorf("failed to ignore fields: %w", err)
+	}
+	return dst, nil
+}
+
+// ignoreTaskDefinitionFields returns the desired task definition whose ignored fields are the live ones
+func ignoreTaskDefinitionFields(live ecs.TaskDefinition, desired ecs.TaskDefinition, paths []string) (ecs.TaskDefinition, error) {
+	if len(paths) == 0 {
+		return desired, nil
+	}
+	var dst ecs.TaskDefinition
+	if err := withIgnoredFields(&live, &desired, paths, &dst); err != nil {
+		return desired, fmt.Errorf("failed to ignore fields: %w", err)
+	}
+	return dst, nil
+}
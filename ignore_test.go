@@ -0,0 +1,84 @@
+package ecsceed
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseFieldPath(t *testing.T) {
+	path, err := parseFieldPath("$.containerDefinitions[*].image")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"containerDefinitions", "image"}, path)
+
+	path, err = parseFieldPath("desiredCount")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"desiredCount"}, path)
+
+	for _, p := range []string{"", "$", "a..b", "containerDefinitions[0].image"} {
+		_, err := parseFieldPath(p)
+		assert.Error(t, err, p)
+	}
+}
+
+func TestIgnoreServiceFields(t *testing.T) {
+	live := ecs.Service{
+		DesiredCount: aws.Int64(7),
+		DeploymentConfiguration: &ecs.DeploymentConfiguration{
+			MaximumPercent:        aws.Int64(200),
+			MinimumHealthyPercent: aws.Int64(100),
+		},
+	}
+	desired := ecs.Service{
+		DesiredCount: aws.Int64(2),
+		DeploymentConfiguration: &ecs.DeploymentConfiguration{
+			MaximumPercent:        aws.Int64(150),
+			MinimumHealthyPercent: aws.Int64(50),
+		},
+		HealthCheckGracePeriodSeconds: aws.Int64(30),
+	}
+
+	got, err := ignoreServiceFields(live, desired, []string{"desiredCount", "deploymentConfiguration.maximumPercent", "healthCheckGracePeriodSeconds"})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(7), *got.DesiredCount)
+	assert.Equal(t, int64(200), *got.DeploymentConfiguration.MaximumPercent)
+	assert.Equal(t, int64(50), *got.DeploymentConfiguration.MinimumHealthyPercent)
+	// not live fields are removed
+	assert.Nil(t, got.HealthCheckGracePeriodSeconds)
+
+	got, err = ignoreServiceFields(live, desired, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, desired, got)
+}
+
+func TestIgnoreTaskDefinitionFields(t *testing.T) {
+	live := ecs.TaskDefinition{
+		Family: aws.String("api"),
+		ContainerDefinitions: []*ecs.ContainerDefinition{
+			{Name: aws.String("sidecar"), Image: aws.String("sidecar:v1")},
+			{Name: aws.String("app"), Image: aws.String("app:v2")},
+		},
+	}
+	desired := ecs.TaskDefinition{
+		Family: aws.String("api"),
+		ContainerDefinitions: []*ecs.ContainerDefinition{
+			{Name: aws.String("app"), Image: aws.String("app:latest"), Cpu: aws.Int64(256)},
+			{Name: aws.String("sidecar"), Image: aws.String("sidecar:latest")},
+			{Name: aws.String("new"), Image: aws.String("new:v1")},
+		},
+	}
+
+	got, err := ignoreTaskDefinitionFields(live, desired, []string{"containerDefinitions[*].image"})
+	assert.NoError(t, err)
+	assert.Equal(t, "app:v2", *got.ContainerDefinitions[0].Image)
+	assert.Equal(t, int64(256), *got.ContainerDefinitions[0].Cpu)
+	assert.Equal(t, "sidecar:v1", *got.ContainerDefinitions[1].Image)
+	// new containers keep the desired values
+	assert.Equal(t, "new:v1", *got.ContainerDefinitions[2].Image)
+
+	d, err := diffTaskDefinition(live, got)
+	assert.NoError(t, err)
+	assert.NotContains(t, d, `"image": "app:latest"`)
+}
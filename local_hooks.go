@@ -0,0 +1,100 @@
+package ecsceed
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/mattn/go-shellwords"
+)
+
+// lifecycle events of local hooks
+const (
+	localHookBeforeRender  = "before_render"
+	localHookAfterRegister = "after_register"
+	localHookAfterStable   = "after_stable"
+	localHookOnFailure     = "on_failure"
+)
+
+var defaultLocalHookTimeout = 5 * time.Minute
+
+var envNameInvalidChars = regexp.MustCompile(`[^A-Z0-9_]`)
+
+// taskDefinitionEnvName returns the environment variable name of the task definition arn
+func taskDefinitionEnvName(name string) string {
+	return "ECSCEED_TASK_DEFINITION_" + envNameInvalidChars.ReplaceAllString(strings.ToUpper(name), "_")
+}
+
+func (a *App) localHookEnv(event string, nameToTdArn map[string]string) []string {
+	env := []string{
+		"ECSCEED_EVENT=" + event,
+		"ECSCEED_CLUSTER=" + a.def.cluster,
+	}
+	for _, name := range a.def.tdNames {
+		if arn, ok := nameToTdArn[name]; ok {
+			env = append(env, taskDefinitionEnvName(name)+"="+arn)
+		}
+	}
+	return env
+}
+
+func (a *App) runLocalHook(ctx context.Context, h ConfigLocalHook, env []string) error {
+	args, err := shellwords.Parse(h.Command)
+	if err != nil {
+		return fmt.Errorf("command parse error. %s", h.Command)
+	}
+	if len(args) == 0 {
+		return fmt.Errorf("command is empty")
+	}
+
+	timeout := defaultLocalHookTimeout
+	if h.Timeout != "" {
+		timeout, err = time.ParseDuration(h.Timeout)
+		if err != nil {
+			return fmt.Errorf("invalid timeout %s: %w", h.Timeout, err)
+		}
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Dir = a.configDir()
+	cmd.Env = append(os.Environ(), env...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return fmt.Errorf("timed out after %s", timeout)
+		}
+		return err
+	}
+	return nil
+}
+
+// runLocalHooks runs local commands of the lifecycle event.
+// A failed hook fails the deploy unless ignore_failure is set.
+func (a *App) runLocalHooks(ctx context.Context, event string, hooks []ConfigLocalHook, dryRun bool, env []string) error {
+	for _, h := range hooks {
+		if dryRun {
+			color.Cyan("> %s local hook: %s", event, h.Command)
+			continue
+		}
+
+		a.Log("Running", event, "local hook", LogTarget(h.Command))
+		if err := a.runLocalHook(ctx, h, env); err != nil {
+			if h.IgnoreFailure {
+				a.Log(color.YellowString("Ignored failure of %s local hook %s: %s", event, h.Command, err))
+				continue
+			}
+			return fmt.Errorf("%s local hook %s failed: %w", event, h.Command, err)
+		}
+		a.Log(LogDone(), event, "local hook", LogTarget(h.Command))
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package ecsceed
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTaskDefinitionEnvName(t *testing.T) {
+	assert.Equal(t, "ECSCEED_TASK_DEFINITION_API", taskDefinitionEnvName("api"))
+	assert.Equal(t, "ECSCEED_TASK_DEFINITION_BATCH_WORKER", taskDefinitionEnvName("batch-worker"))
+}
+
+func TestRunLocalHooks(t *testing.T) {
+	app := &App{
+		def: Definition{
+			cluster: "my-cluster",
+			tdNames: []string{"api"},
+		},
+	}
+	env := app.localHookEnv(localHookAfterRegister, map[string]string{"api": "arn:aws:ecs:ap-northeast-1:123456789012:task-definition/api:3"})
+
+	ok := ConfigLocalHook{Command: `sh -c 'test "$ECSCEED_TASK_DEFINITION_API" = "arn:aws:ecs:ap-northeast-1:123456789012:task-definition/api:3"'`}
+	assert.NoError(t, app.runLocalHooks(context.Background(), localHookAfterRegister, []ConfigLocalHook{ok}, false, env))
+
+	failed := ConfigLocalHook{Command: "sh -c 'exit 1'"}
+	assert.Error(t, app.runLocalHooks(context.Background(), localHookAfterRegister, []ConfigLocalHook{failed}, false, env))
+
+	failed.IgnoreFailure = true
+	assert.NoError(t, app.runLocalHooks(context.Background(), localHookAfterRegister, []ConfigLocalHook{failed}, false, env))
+
+	slow := ConfigLocalHook{Command: "sleep 5", Timeout: "100ms"}
+	err := app.runLocalHooks(context.Background(), localHookAfterRegister, []ConfigLocalHook{slow}, false, env)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "timed out")
+	}
+}
@@ -0,0 +1,297 @@
+package ecsceed
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"os/user"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/fatih/color"
+)
+
+// The deploy lock is an advisory lock stored as tags on the cluster.
+// Tagging is not atomic, so the lock is verified by reading it back after written.
+// The expiry is extended while the lock is held, so it expires only when the holder is gone.
+
+var lockTTL = 15 * time.Minute
+var lockRefreshInterval = 5 * time.Minute
+var lockPollInterval = 10 * time.Second
+var lockVerifyDelay = 2 * time.Second
+
+var invalidTagChars = regexp.MustCompile(`[^\pL\pN\s_.:/=+\-@]`)
+
+type deployLock struct {
+	ID      string
+	Owner   string
+	Reason  string
+	Expires time.Time
+}
+
+func (l *deployLock) expired() bool {
+	return time.Now().After(l.Expires)
+}
+
+func (l *deployLock) String() string {
+	return fmt.Sprintf("owner=%s reason=%s expires=%s", l.Owner, l.Reason, l.Expires.In(timezone).Format("2006/01/02 15:04:05"))
+}
+
+func sanitizeTagValue(v string) string {
+	return invalidTagChars.ReplaceAllString(v, "_")
+}
+
+func lockOwner() string {
+	name := "unknown"
+	if u, err := user.Current(); err == nil {
+		name = u.Username
+	}
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	return sanitizeTagValue(fmt.Sprintf("%s@%s", name, host))
+}
+
+func newLockID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// lockTagKey returns the tag key of the lock. The lock is shared by overlays deploying the same names.
+func (a *App) lockTagKey(field string) string {
+	return fmt.Sprintf("ecsceed:lock/%s/%s:%s", a.def.namePrefix, a.def.nameSuffix, field)
+}
+
+func (a *App) clusterArn(ctx context.Context) (string, error) {
+	cluster, err := a.DescribeCluster(ctx, a.def.cluster)
+	if err != nil {
+		return "", err
+	}
+	if cluster == nil {
+		return "", fmt.Errorf("cluster %s is not found", a.def.cluster)
+	}
+	return *cluster.ClusterArn, nil
+}
+
+func (a *App) readLock(ctx context.Context, arn string) (*deployLock, error) {
+	out, err := a.ecs.ListTagsForResourceWithContext(ctx, &ecs.ListTagsForResourceInput{
+		ResourceArn: aws.String(arn),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	id := tagValue(out.Tags, a.lockTagKey("id"))
+	if id == "" {
+		return nil, nil
+	}
+	l := &deployLock{
+		ID:     id,
+		Owner:  tagValue(out.Tags, a.lockTagKey("owner")),
+		Reason: tagValue(out.Tags, a.lockTagKey("reason")),
+	}
+	if t, err := time.Parse(time.RFC3339, tagValue(out.Tags, a.lockTagKey("expires"))); err == nil {
+		l.Expires = t
+	}
+	return l, nil
+}
+
+func (a *App) writeLock(ctx context.Context, arn string, l *deployLock) error {
+	_, err := a.ecs.TagResourceWithContext(ctx, &ecs.TagResourceInput{
+		ResourceArn: aws.String(arn),
+		Tags: []*ecs.Tag{
+			{Key: aws.String(a.lockTagKey("id")), Value: aws.String(l.ID)},
+			{Key: aws.String(a.lockTagKey("owner")), Value: aws.String(l.Owner)},
+			{Key: aws.String(a.lockTagKey("reason")), Value: aws.String(sanitizeTagValue(l.Reason))},
+			{Key: aws.String(a.lockTagKey("expires")), Value: aws.String(l.Expires.UTC().Format(time.RFC3339))},
+		},
+	})
+	return err
+}
+
+func (a *App) deleteLock(ctx context.Context, arn string) error {
+	_, err := a.ecs.UntagResourceWithContext(ctx, &ecs.UntagResourceInput{
+		ResourceArn: aws.String(arn),
+		TagKeys: aws.StringSlice([]string{
+			a.lockTagKey("id"),
+			a.lockTagKey("owner"),
+			a.lockTagKey("reason"),
+			a.lockTagKey("expires"),
+		}),
+	})
+	return err
+}
+
+// acquireLock acquires the deploy lock, waiting for the other lock up to wait.
+// The returned function releases the lock.
+func (a *App) acquireLock(ctx context.Context, reason string, wait time.Duration) (func(), error) {
+	arn, err := a.clusterArn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	deadline := time.Now().Add(wait)
+	for {
+		curr, err := a.readLock(ctx, arn)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read lock: %w", err)
+		}
+
+		if curr == nil || curr.expired() {
+			id, err := newLockID()
+			if err != nil {
+				return nil, fmt.Errorf("failed to generate lock id: %w", err)
+			}
+			l := &deployLock{
+				ID:      id,
+				Owner:   lockOwner(),
+				Reason:  reason,
+				Expires: time.Now().Add(lockTTL),
+			}
+			if err := a.writeLock(ctx, arn, l); err != nil {
+				return nil, fmt.Errorf("failed to write lock: %w", err)
+			}
+
+			// verify that the other didn't overwrite the lock
+			time.Sleep(lockVerifyDelay)
+			written, err := a.readLock(ctx, arn)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read lock: %w", err)
+			}
+			if written != nil && written.ID == l.ID {
+				a.Log(LogDone(), "Acquired lock", LogTarget(l.String()))
+				stop := a.refreshLock(arn, l)
+				return func() {
+					stop()
+					a.releaseLock(arn, l.ID)
+				}, nil
+			}
+			curr = written
+		}
+
+		if curr != nil {
+			if !time.Now().Before(deadline) {
+				return nil, fmt.Errorf("locked by the other: %s", curr)
+			}
+			a.Log("Waiting for lock", LogTarget(curr.String()))
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(lockPollInterval):
+		}
+	}
+}
+
+// refreshLock extends the expiry of the held lock periodically until the returned function is called
+func (a *App) refreshLock(arn string, l *deployLock) func() {
+	ctx, cancel := context.WithCancel(cleanupContext())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(lockRefreshInterval):
+			}
+			curr, err := a.readLock(ctx, arn)
+			if err != nil {
+				a.Log(color.YellowString("Failed to read lock: %s", err))
+				continue
+			}
+			if curr == nil || curr.ID != l.ID {
+				a.Log(color.YellowString("Lock was taken by the other"))
+				return
+			}
+			next := *l
+			next.Expires = time.Now().Add(lockTTL)
+			if err := a.writeLock(ctx, arn, &next); err != nil {
+				a.Log(color.YellowString("Failed to refresh lock: %s", err))
+				continue
+			}
+			a.DebugLog("Refreshed lock", LogTarget(next.String()))
+		}
+	}()
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+func (a *App) releaseLock(arn string, id string) {
+	ctx := cleanupContext()
+	curr, err := a.readLock(ctx, arn)
+	if err != nil {
+		a.Log(color.YellowString("Failed to read lock: %s", err))
+		return
+	}
+	if curr == nil || curr.ID != id {
+		a.Log(color.YellowString("Lock was taken by the other"))
+		return
+	}
+	if err := a.deleteLock(ctx, arn); err != nil {
+		a.Log(color.YellowString("Failed to release lock: %s", err))
+		return
+	}
+	a.Log(LogDone(), "Released lock")
+}
+
+func (a *App) LockStatus(ctx context.Context) error {
+	arn, err := a.clusterArn(ctx)
+	if err != nil {
+		return err
+	}
+	l, err := a.readLock(ctx, arn)
+	if err != nil {
+		return err
+	}
+	if l == nil {
+		fmt.Println("Not locked")
+		return nil
+	}
+	status := "Locked"
+	if l.expired() {
+		status = "Expired"
+	}
+	fmt.Printf("%s: %s\n", status, l)
+	return nil
+}
+
+type ReleaseLockOption struct {
+	Force bool
+}
+
+// ReleaseLock releases the lock. A lock of the other owner is released only with force.
+func (a *App) ReleaseLock(ctx context.Context, opt ReleaseLockOption) error {
+	arn, err := a.clusterArn(ctx)
+	if err != nil {
+		return err
+	}
+	l, err := a.readLock(ctx, arn)
+	if err != nil {
+		return err
+	}
+	if l == nil {
+		a.Log("Not locked")
+		return nil
+	}
+	if !opt.Force && !l.expired() && !strings.EqualFold(l.Owner, lockOwner()) {
+		return fmt.Errorf("locked by the other: %s. use --force to release", l)
+	}
+	if err := a.deleteLock(ctx, arn); err != nil {
+		return err
+	}
+	a.Log(LogDone(), "Released lock", LogTarget(l.String()))
+	return nil
+}
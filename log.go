@@ -9,9 +9,19 @@ import (
 )
 
 func (a *App) Log(v ...interface{}) {
+	if a.logPrefix != "" {
+		v = append([]interface{}{a.logPrefix}, v...)
+	}
 	log.Println(v...)
 }
 
+// withLogPrefix returns a copy of the app which logs with the prefix (e.g. for parallel updates)
+func (a *App) withLogPrefix(prefix string) *App {
+	c := *a
+	c.logPrefix = prefix
+	return &c
+}
+
 func (a *App) DebugLog(v ...interface{}) {
 	if !a.Debug {
 		return
@@ -0,0 +1,184 @@
+package ecsceed
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/fatih/color"
+)
+
+// tag keys of services managed by ecsceed
+const (
+	tagManaged    = "ecsceed:managed"
+	tagCluster    = "ecsceed:cluster"
+	tagNamePrefix = "ecsceed:name-prefix"
+	tagNameSuffix = "ecsceed:name-suffix"
+	tagConfigHash = "ecsceed:config-hash"
+)
+
+type PruneServicesOption struct {
+	DryRun      bool
+	Yes         bool
+	WaitForLock time.Duration
+	Timeout     time.Duration
+}
+
+// configHash is the hash of the config path relative to the git repository if any, to tell where the overlay was deployed from
+func (a *App) configHash() string {
+	if len(a.cs) == 0 {
+		return ""
+	}
+	path, err := filepath.Abs(a.cs[len(a.cs)-1].path)
+	if err != nil {
+		path = a.cs[len(a.cs)-1].path
+	}
+	if top := gitOutput(a.configDir(), "rev-parse", "--show-toplevel"); top != "" {
+		if rel, err := filepath.Rel(top, path); err == nil && !strings.HasPrefix(rel, "..") {
+			path = filepath.ToSlash(rel)
+		}
+	}
+	h := sha256.Sum256([]byte(path))
+	return hex.EncodeToString(h[:])[:16]
+}
+
+// managedTags are the tags to identify services managed by the overlay.
+// The overlay is identified by the cluster and the name prefix and suffix, and the config hash only tells where it was deployed from.
+func (a *App) managedTags() []*ecs.Tag {
+	return []*ecs.Tag{
+		{Key: aws.String(tagManaged), Value: aws.String("true")},
+		{Key: aws.String(tagCluster), Value: aws.String(arnToName(a.def.cluster))},
+		{Key: aws.String(tagNamePrefix), Value: aws.String(a.def.namePrefix)},
+		{Key: aws.String(tagNameSuffix), Value: aws.String(a.def.nameSuffix)},
+		{Key: aws.String(tagConfigHash), Value: aws.String(a.configHash())},
+	}
+}
+
+func (a *App) isManaged(tags []*ecs.Tag) bool {
+	return tagValue(tags, tagManaged) == "true" &&
+		tagValue(tags, tagCluster) == arnToName(a.def.cluster) &&
+		tagValue(tags, tagNamePrefix) == a.def.namePrefix &&
+		tagValue(tags, tagNameSuffix) == a.def.nameSuffix
+}
+
+// prunableServices filters the services managed by the overlay which are no longer in config
+func (a *App) prunableServices(services []*ecs.Service) []*ecs.Service {
+	prunable := []*ecs.Service{}
+	for _, s := range services {
+		if *s.Status != "ACTIVE" || !a.isManaged(s.Tags) {
+			continue
+		}
+		name := *s.ServiceName
+		// the temporary service may serve while recreating
+		if strings.HasSuffix(name, recreateServiceSuffix) {
+			continue
+		}
+		if !strings.HasPrefix(name, a.def.namePrefix) || !strings.HasSuffix(name, a.def.nameSuffix) {
+			continue
+		}
+		if _, ok := a.def.nameToSrv[a.resolveKeyName(name)]; ok {
+			continue
+		}
+		prunable = append(prunable, s)
+	}
+	return prunable
+}
+
+func (a *App) findPrunableServices(ctx context.Context) ([]*ecs.Service, error) {
+	arns, err := a.ListClusterServices(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(arns) == 0 {
+		return nil, nil
+	}
+	desc, err := a.DescribeServicesWithTags(ctx, arns)
+	if err != nil {
+		return nil, err
+	}
+	return a.prunableServices(desc.Services), nil
+}
+
+// printPrunable lists the services and scheduled tasks, noting the services deployed from the other config path
+func printPrunable(services []*ecs.Service, scheduledTasks []string, configHash string) {
+	for _, s := range services {
+		note := ""
+		if tagValue(s.Tags, tagConfigHash) != configHash {
+			note = " deployed from the other config path"
+		}
+		color.Red("- service: %s (desired:%d running:%d)%s", *s.ServiceName, *s.DesiredCount, *s.RunningCount, note)
+	}
+	for _, r := range scheduledTasks {
+		color.Red("- scheduled task: %s", r)
+	}
+}
+
+// deletePrunable stops the schedules before the services
+func (a *App) deletePrunable(ctx context.Context, services []*ecs.Service, scheduledTasks []string) error {
+	for _, r := range scheduledTasks {
+		if err := a.deleteScheduledTask(ctx, r); err != nil {
+			return fmt.Errorf("failed to delete scheduled task %s: %w", r, err)
+		}
+		a.Log(LogDone(), "Deleted scheduled task", LogTarget(r))
+	}
+	return a.deleteServices(ctx, services)
+}
+
+// PruneServices deletes the services and scheduled tasks managed by the overlay which are removed from config
+func (a *App) PruneServices(ctx context.Context, opt PruneServicesOption) error {
+	if !opt.DryRun {
+		release, err := a.acquireLock(ctx, "prune-services", opt.WaitForLock)
+		if err != nil {
+			return err
+		}
+		defer release()
+	}
+
+	err := a.ResolveConfigStack(Params{})
+	if err != nil {
+		return err
+	}
+
+	services, err := a.findPrunableServices(ctx)
+	if err != nil {
+		return err
+	}
+	scheduledTasks, err := a.findPrunableScheduledTasks(ctx)
+	if err != nil {
+		return err
+	}
+	if len(services) == 0 && len(scheduledTasks) == 0 {
+		a.Log("No services to prune")
+		return nil
+	}
+
+	printPrunable(services, scheduledTasks, a.configHash())
+	if opt.DryRun {
+		return nil
+	}
+
+	if !opt.Yes {
+		ok, err := confirmOnTerminal("Are you sure to delete these services?")
+		if err != nil {
+			return err
+		}
+		if !ok {
+			a.Log("Prune is canceled")
+			return nil
+		}
+	}
+
+	if opt.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opt.Timeout)
+		defer cancel()
+	}
+
+	return a.deletePrunable(ctx, services, scheduledTasks)
+}
@@ -0,0 +1,51 @@
+package ecsceed
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrunableServices(t *testing.T) {
+	app := &App{
+		def: Definition{
+			cluster:    "arn:aws:ecs:ap-northeast-1:123456789012:cluster/dev",
+			namePrefix: "dev-",
+			nameToSrv: map[string]Service{
+				"api": {},
+			},
+		},
+	}
+	tags := func(cluster, prefix, hash string) []*ecs.Tag {
+		return []*ecs.Tag{
+			{Key: aws.String(tagManaged), Value: aws.String("true")},
+			{Key: aws.String(tagCluster), Value: aws.String(cluster)},
+			{Key: aws.String(tagNamePrefix), Value: aws.String(prefix)},
+			{Key: aws.String(tagNameSuffix), Value: aws.String("")},
+			{Key: aws.String(tagConfigHash), Value: aws.String(hash)},
+		}
+	}
+	service := func(name string, status string, tags []*ecs.Tag) *ecs.Service {
+		return &ecs.Service{ServiceName: aws.String(name), Status: aws.String(status), Tags: tags}
+	}
+
+	services := []*ecs.Service{
+		service("dev-api", "ACTIVE", tags("dev", "dev-", "abc")),
+		service("dev-worker", "ACTIVE", tags("dev", "dev-", "abc")),
+		service("dev-batch", "DRAINING", tags("dev", "dev-", "abc")),
+		service("dev-api-recreating", "ACTIVE", tags("dev", "dev-", "abc")),
+		// the config hash changes with the config path, but the overlay is the same
+		service("dev-moved", "ACTIVE", tags("dev", "dev-", "def")),
+		service("dev-other", "ACTIVE", tags("stg", "dev-", "abc")),
+		service("prd-worker", "ACTIVE", tags("dev", "prd-", "abc")),
+		service("dev-manual", "ACTIVE", nil),
+	}
+
+	prunable := app.prunableServices(services)
+	if assert.Len(t, prunable, 2) {
+		assert.Equal(t, "dev-worker", *prunable[0].ServiceName)
+		assert.Equal(t, "dev-moved", *prunable[1].ServiceName)
+	}
+}
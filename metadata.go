@@ -0,0 +1,158 @@
+package ecsceed
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+)
+
+// Version is the ecsceed version set at build time
+var Version = "dev"
+
+// tag keys recorded at deploy time
+const (
+	tagGitSHA     = "ecsceed:git-sha"
+	tagGitBranch  = "ecsceed:git-branch"
+	tagVersion    = "ecsceed:version"
+	tagParamsHash = "ecsceed:params-hash"
+	tagDeployedBy = "ecsceed:deployed-by"
+	tagCIURL      = "ecsceed:ci-url"
+)
+
+// metadataTagKeys is the order of deploy metadata in history
+var metadataTagKeys = []string{
+	tagGitSHA,
+	tagGitBranch,
+	tagVersion,
+	tagParamsHash,
+	tagDeployedBy,
+	tagCIURL,
+}
+
+const maxTagValueLength = 256
+
+func gitOutput(dir string, args ...string) string {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	out, err := cmd.Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
+
+func (a *App) configDir() string {
+	if len(a.cs) == 0 {
+		return "."
+	}
+	return a.cs[len(a.cs)-1].dir
+}
+
+// paramsHash is a short hash of the effective params
+func paramsHash(params Params) string {
+	keys := make([]string, 0, len(params))
+	for k := range params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	h := sha256.New()
+	for _, k := range keys {
+		fmt.Fprintf(h, "%s=%s\n", k, params[k])
+	}
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+// ciRunURL finds the url of the CI run from the environment variables of common CI services
+func ciRunURL(getenv func(string) string) string {
+	if getenv("GITHUB_ACTIONS") == "true" && getenv("GITHUB_RUN_ID") != "" {
+		server := getenv("GITHUB_SERVER_URL")
+		if server == "" {
+			server = "https://github.com"
+		}
+		return fmt.Sprintf("%s/%s/actions/runs/%s", server, getenv("GITHUB_REPOSITORY"), getenv("GITHUB_RUN_ID"))
+	}
+	for _, key := range []string{
+		"CI_JOB_URL",           // GitLab CI
+		"CIRCLE_BUILD_URL",     // CircleCI
+		"BUILDKITE_BUILD_URL",  // Buildkite
+		"TRAVIS_BUILD_WEB_URL", // Travis CI
+		"BUILD_URL",            // Jenkins
+	} {
+		if v := getenv(key); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+func newTag(key, value string) *ecs.Tag {
+	value = sanitizeTagValue(value)
+	if len(value) > maxTagValueLength {
+		value = value[:maxTagValueLength]
+	}
+	return &ecs.Tag{Key: aws.String(key), Value: aws.String(value)}
+}
+
+func (a *App) deployTags(opt DeployOption) []*ecs.Tag {
+	tags := []*ecs.Tag{}
+
+	sha := opt.GitSHA
+	if sha == "" {
+		sha = gitOutput(a.configDir(), "rev-parse", "HEAD")
+	}
+	if sha != "" {
+		tags = append(tags, newTag(tagGitSHA, sha))
+	}
+
+	branch := opt.GitBranch
+	if branch == "" {
+		branch = gitOutput(a.configDir(), "rev-parse", "--abbrev-ref", "HEAD")
+	}
+	if branch != "" && branch != "HEAD" {
+		tags = append(tags, newTag(tagGitBranch, branch))
+	}
+
+	tags = append(tags,
+		newTag(tagVersion, Version),
+		newTag(tagParamsHash, paramsHash(a.def.params)),
+		newTag(tagDeployedBy, lockOwner()),
+	)
+
+	if url := ciRunURL(os.Getenv); url != "" {
+		tags = append(tags, newTag(tagCIURL, url))
+	}
+
+	return tags
+}
+
+// mergeTags returns tags overwritten by ex
+func mergeTags(base []*ecs.Tag, ex []*ecs.Tag) []*ecs.Tag {
+	keys := map[string]bool{}
+	for _, t := range ex {
+		keys[*t.Key] = true
+	}
+	dst := []*ecs.Tag{}
+	for _, t := range base {
+		if !keys[*t.Key] {
+			dst = append(dst, t)
+		}
+	}
+	return append(dst, ex...)
+}
+
+func tagValue(tags []*ecs.Tag, key string) string {
+	for _, t := range tags {
+		if *t.Key == key {
+			return aws.StringValue(t.Value)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,45 @@
+package ecsceed
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParamsHash(t *testing.T) {
+	h := paramsHash(Params{"ImageTag": "v1", "Env": "develop"})
+	assert.Len(t, h, 16)
+	assert.Equal(t, h, paramsHash(Params{"Env": "develop", "ImageTag": "v1"}))
+	assert.NotEqual(t, h, paramsHash(Params{"Env": "develop", "ImageTag": "v2"}))
+}
+
+func TestCIRunURL(t *testing.T) {
+	env := func(m map[string]string) func(string) string {
+		return func(k string) string { return m[k] }
+	}
+
+	assert.Equal(t, "https://github.com/maruware/ecsceed/actions/runs/42", ciRunURL(env(map[string]string{
+		"GITHUB_ACTIONS":    "true",
+		"GITHUB_SERVER_URL": "https://github.com",
+		"GITHUB_REPOSITORY": "maruware/ecsceed",
+		"GITHUB_RUN_ID":     "42",
+	})))
+	assert.Equal(t, "https://gitlab.com/g/p/-/jobs/1", ciRunURL(env(map[string]string{
+		"CI_JOB_URL": "https://gitlab.com/g/p/-/jobs/1",
+	})))
+	assert.Equal(t, "", ciRunURL(env(map[string]string{})))
+}
+
+func TestMergeTags(t *testing.T) {
+	base := []*ecs.Tag{
+		{Key: aws.String("team"), Value: aws.String("web")},
+		{Key: aws.String(tagGitSHA), Value: aws.String("old")},
+	}
+	tags := mergeTags(base, []*ecs.Tag{newTag(tagGitSHA, "new")})
+
+	assert.Len(t, tags, 2)
+	assert.Equal(t, "web", tagValue(tags, "team"))
+	assert.Equal(t, "new", tagValue(tags, tagGitSHA))
+}
@@ -0,0 +1,187 @@
+package ecsceed
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+)
+
+// notification events
+const (
+	NotifyDeployStart   = "deploy_start"
+	NotifyDeploySuccess = "deploy_success"
+	NotifyDeployFailure = "deploy_failure"
+	NotifyRollback      = "rollback"
+	NotifyRun           = "run"
+)
+
+// notification types
+const (
+	notificationTypeWebhook = "webhook"
+	notificationTypeSlack   = "slack"
+)
+
+var notificationTimeout = 10 * time.Second
+
+type NotificationRevision struct {
+	Service string `json:"service"`
+	From    string `json:"from,omitempty"`
+	To      string `json:"to"`
+}
+
+type Notification struct {
+	Event     string                 `json:"event"`
+	Cluster   string                 `json:"cluster"`
+	Services  []string               `json:"services,omitempty"`
+	Revisions []NotificationRevision `json:"revisions,omitempty"`
+	Duration  float64                `json:"duration_seconds"`
+	Error     string                 `json:"error,omitempty"`
+}
+
+func (n Notification) text() string {
+	var title string
+	switch n.Event {
+	case NotifyDeployStart:
+		title = "Deploy started"
+	case NotifyDeploySuccess:
+		title = "Deploy succeeded"
+	case NotifyDeployFailure:
+		title = "Deploy failed"
+	case NotifyRollback:
+		title = "Rollback completed"
+		if n.Error != "" {
+			title = "Rollback failed"
+		}
+	case NotifyRun:
+		title = "Run task completed"
+		if n.Error != "" {
+			title = "Run task failed"
+		}
+	default:
+		title = n.Event
+	}
+
+	lines := []string{fmt.Sprintf("[ecsceed] %s: cluster=%s", title, n.Cluster)}
+	if len(n.Revisions) > 0 {
+		for _, r := range n.Revisions {
+			if r.From == "" {
+				lines = append(lines, fmt.Sprintf("- %s: %s", r.Service, r.To))
+			} else {
+				lines = append(lines, fmt.Sprintf("- %s: %s -> %s", r.Service, r.From, r.To))
+			}
+		}
+	} else if len(n.Services) > 0 {
+		lines = append(lines, "services: "+strings.Join(n.Services, ", "))
+	}
+	if n.Duration > 0 {
+		lines = append(lines, fmt.Sprintf("duration: %.0fs", n.Duration))
+	}
+	if n.Error != "" {
+		lines = append(lines, "error: "+n.Error)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func notificationPayload(typ string, n Notification) ([]byte, error) {
+	switch typ {
+	case notificationTypeSlack:
+		return json.Marshal(map[string]string{"text": n.text()})
+	case notificationTypeWebhook, "":
+		return json.Marshal(n)
+	}
+	return nil, fmt.Errorf("unknown notification type %s", typ)
+}
+
+func validateNotifications(notifications []ConfigNotification) error {
+	events := map[string]bool{
+		NotifyDeployStart:   true,
+		NotifyDeploySuccess: true,
+		NotifyDeployFailure: true,
+		NotifyRollback:      true,
+		NotifyRun:           true,
+	}
+	for _, c := range notifications {
+		switch c.Type {
+		case notificationTypeWebhook, notificationTypeSlack, "":
+		default:
+			return fmt.Errorf("unknown notification type %s", c.Type)
+		}
+		if c.URL == "" {
+			return fmt.Errorf("notification requires url")
+		}
+		for _, e := range c.Events {
+			if !events[e] {
+				return fmt.Errorf("unknown notification event %s", e)
+			}
+		}
+	}
+	return nil
+}
+
+func (c ConfigNotification) accepts(event string) bool {
+	if len(c.Events) == 0 {
+		return true
+	}
+	for _, e := range c.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+func sendNotification(ctx context.Context, c ConfigNotification, n Notification) error {
+	body, err := notificationPayload(c.Type, n)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, notificationTimeout)
+	defer cancel()
+
+	req, err := http.NewRequest(http.MethodPost, c.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %s", res.Status)
+	}
+	return nil
+}
+
+// notify sends the notification to the configured destinations.
+// Failures are only logged not to fail the command.
+func (a *App) notify(n Notification) {
+	n.Cluster = a.def.cluster
+	for _, c := range a.def.notifications {
+		if !c.accepts(n.Event) {
+			continue
+		}
+		if err := sendNotification(cleanupContext(), c, n); err != nil {
+			a.Log(color.YellowString("Failed to send %s notification: %s", n.Event, err))
+			continue
+		}
+		a.DebugLog("sent notification", n.Event, c.URL)
+	}
+}
+
+func errorString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
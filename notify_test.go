@@ -0,0 +1,69 @@
+package ecsceed
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNotify(t *testing.T) {
+	received := map[string][]map[string]interface{}{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Error(err)
+		}
+		received[r.URL.Path] = append(received[r.URL.Path], body)
+	}))
+	defer server.Close()
+
+	app := &App{
+		def: Definition{
+			cluster: "my-cluster",
+			notifications: []ConfigNotification{
+				{Type: "webhook", URL: server.URL + "/webhook"},
+				{Type: "slack", URL: server.URL + "/slack", Events: []string{NotifyDeployFailure}},
+			},
+		},
+	}
+
+	app.notify(Notification{
+		Event:     NotifyDeploySuccess,
+		Revisions: []NotificationRevision{{Service: "api-develop", From: "api-develop:3", To: "api-develop:4"}},
+		Duration:  42,
+	})
+	app.notify(Notification{
+		Event: NotifyDeployFailure,
+		Error: errorString(errors.New("service api-develop failed")),
+	})
+
+	webhook := received["/webhook"]
+	if assert.Len(t, webhook, 2) {
+		assert.Equal(t, NotifyDeploySuccess, webhook[0]["event"])
+		assert.Equal(t, "my-cluster", webhook[0]["cluster"])
+		assert.Equal(t, float64(42), webhook[0]["duration_seconds"])
+		assert.Equal(t, "service api-develop failed", webhook[1]["error"])
+	}
+
+	slack := received["/slack"]
+	if assert.Len(t, slack, 1) {
+		text := slack[0]["text"].(string)
+		assert.True(t, strings.HasPrefix(text, "[ecsceed] Deploy failed"))
+		assert.Contains(t, text, "service api-develop failed")
+	}
+}
+
+func TestValidateNotifications(t *testing.T) {
+	assert.NoError(t, validateNotifications([]ConfigNotification{
+		{URL: "https://example.com/hook"},
+		{Type: "slack", URL: "https://hooks.slack.com/services/x", Events: []string{"deploy_failure", "rollback"}},
+	}))
+	assert.Error(t, validateNotifications([]ConfigNotification{{Type: "teams", URL: "https://example.com/hook"}}))
+	assert.Error(t, validateNotifications([]ConfigNotification{{Type: "webhook"}}))
+	assert.Error(t, validateNotifications([]ConfigNotification{{URL: "https://example.com/hook", Events: []string{"deploy"}}}))
+}
@@ -0,0 +1,182 @@
+package ecsceed
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/fatih/color"
+	"github.com/pkg/errors"
+)
+
+type PruneOption struct {
+	Keep            int
+	KeepDuration    time.Duration
+	TaskDefinitions []string
+	DryRun          bool
+	JSON            bool
+	WaitForLock     time.Duration
+}
+
+// reasons to keep a revision
+const (
+	pruneKeepNewest = "newest"
+	pruneKeepRecent = "recent"
+	pruneKeepInUse  = "in use"
+)
+
+type PruneRevision struct {
+	TaskDefinition string     `json:"taskDefinition"`
+	RegisteredAt   *time.Time `json:"registeredAt,omitempty"`
+	Action         string     `json:"action"`
+	Reason         string     `json:"reason,omitempty"`
+}
+
+type PruneReport struct {
+	DryRun    bool            `json:"dryRun"`
+	Revisions []PruneRevision `json:"revisions"`
+}
+
+// pruneReason returns the reason to keep the i-th newest revision, or empty to deregister it
+func pruneReason(i int, td *ecs.TaskDefinition, inUse map[string]bool, opt PruneOption, now time.Time) string {
+	if i < opt.Keep {
+		return pruneKeepNewest
+	}
+	if inUse[*td.TaskDefinitionArn] {
+		return pruneKeepInUse
+	}
+	if opt.KeepDuration > 0 && td.RegisteredAt != nil && now.Sub(*td.RegisteredAt) < opt.KeepDuration {
+		return pruneKeepRecent
+	}
+	return ""
+}
+
+// taskDefinitionsInUse collects revisions referenced by services, task sets and running tasks in the cluster
+func (a *App) taskDefinitionsInUse(ctx context.Context) (map[string]bool, error) {
+	inUse := map[string]bool{}
+
+	arns, err := a.ListClusterServices(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(arns) > 0 {
+		desc, err := a.DescribeServices(ctx, arns)
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range desc.Services {
+			if s.TaskDefinition != nil {
+				inUse[*s.TaskDefinition] = true
+			}
+			for _, d := range s.Deployments {
+				inUse[*d.TaskDefinition] = true
+			}
+			for _, ts := range s.TaskSets {
+				inUse[*ts.TaskDefinition] = true
+			}
+		}
+	}
+
+	tasks, err := a.ListClusterTasks(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range tasks {
+		inUse[*t.TaskDefinitionArn] = true
+	}
+
+	if err := a.scheduledTaskDefinitionsInUse(ctx, inUse); err != nil {
+		return nil, err
+	}
+
+	return inUse, nil
+}
+
+// Prune deregisters old revisions of the families in config
+func (a *App) Prune(ctx context.Context, opt PruneOption) error {
+	if !opt.DryRun {
+		release, err := a.acquireLock(ctx, "prune", opt.WaitForLock)
+		if err != nil {
+			return err
+		}
+		defer release()
+	}
+
+	err := a.ResolveConfigStack(Params{})
+	if err != nil {
+		return err
+	}
+	names, err := a.selectFamilies(opt.TaskDefinitions)
+	if err != nil {
+		return err
+	}
+	if opt.Keep < 1 {
+		return fmt.Errorf("keep must be at least 1")
+	}
+
+	inUse, err := a.taskDefinitionsInUse(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to find task definitions in use")
+	}
+
+	report := PruneReport{DryRun: opt.DryRun, Revisions: []PruneRevision{}}
+	now := time.Now()
+	for _, name := range names {
+		family := a.resolveFullName(name)
+		arns, err := a.ListTaskDefinitionRevisions(ctx, family, ecs.TaskDefinitionStatusActive, 0)
+		if err != nil {
+			return err
+		}
+
+		for i, arn := range arns {
+			td, err := a.DescribeTaskDefinition(ctx, arn)
+			if err != nil {
+				return err
+			}
+			rev := PruneRevision{
+				TaskDefinition: arnToName(arn),
+				RegisteredAt:   td.RegisteredAt,
+				Action:         "keep",
+				Reason:         pruneReason(i, td, inUse, opt, now),
+			}
+			if rev.Reason == "" {
+				rev.Action = "deregister"
+				if opt.DryRun {
+					if !opt.JSON {
+						color.Red("- task definition: %s", rev.TaskDefinition)
+					}
+				} else {
+					if err := a.DeregisterTaskDefinition(ctx, arn); err != nil {
+						return fmt.Errorf("failed to deregister task definition %s: %w", rev.TaskDefinition, err)
+					}
+					a.Log(LogDone(), "Deregistered", LogTarget(rev.TaskDefinition))
+				}
+			} else {
+				a.DebugLog("keep", rev.TaskDefinition, rev.Reason)
+			}
+			report.Revisions = append(report.Revisions, rev)
+		}
+	}
+
+	if opt.JSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(report)
+	}
+
+	deregistered := 0
+	for _, rev := range report.Revisions {
+		if rev.Action == "deregister" {
+			deregistered++
+		}
+	}
+	if opt.DryRun {
+		a.Log(fmt.Sprintf("%d task definitions will be deregistered (dry run)", deregistered))
+	} else {
+		a.Log(fmt.Sprintf("Deregistered %d task definitions", deregistered))
+	}
+	return nil
+}
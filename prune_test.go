@@ -0,0 +1,32 @@
+package ecsceed
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPruneReason(t *testing.T) {
+	now := time.Date(2020, 8, 1, 12, 0, 0, 0, time.UTC)
+	td := func(rev string, age time.Duration) *ecs.TaskDefinition {
+		return &ecs.TaskDefinition{
+			TaskDefinitionArn: aws.String("arn:aws:ecs:ap-northeast-1:123456789012:task-definition/api:" + rev),
+			RegisteredAt:      aws.Time(now.Add(-age)),
+		}
+	}
+	inUse := map[string]bool{
+		"arn:aws:ecs:ap-northeast-1:123456789012:task-definition/api:3": true,
+	}
+	opt := PruneOption{Keep: 2, KeepDuration: 24 * time.Hour}
+
+	assert.Equal(t, pruneKeepNewest, pruneReason(0, td("10", 30*24*time.Hour), inUse, opt, now))
+	assert.Equal(t, pruneKeepRecent, pruneReason(2, td("8", time.Hour), inUse, opt, now))
+	assert.Equal(t, pruneKeepInUse, pruneReason(5, td("3", 30*24*time.Hour), inUse, opt, now))
+	assert.Equal(t, "", pruneReason(5, td("4", 30*24*time.Hour), inUse, opt, now))
+
+	opt.KeepDuration = 0
+	assert.Equal(t, "", pruneReason(2, td("8", time.Hour), inUse, opt, now))
+}
@@ -3,47 +3,207 @@ package ecsceed
 import (
 	"context"
 	"fmt"
+	"regexp"
+	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
 	"github.com/fatih/color"
 	"github.com/pkg/errors"
 )
 
+// serviceSnapshot is a service state before deploy for auto rollback
+type serviceSnapshot struct {
+	name           string
+	taskDefinition string
+	desiredCount   *int64
+}
+
 type RollbackOption struct {
 	NoWait                   bool
 	ForceNewDeployment       bool
 	DeregisterTaskDefinition bool
 	DryRun                   bool
+	Timeout                  time.Duration
+	To                       string
+	Services                 []string
+	ExcludeServices          []string
+	WaitForLock              time.Duration
+}
+
+var rollbackTimeLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+}
+
+var gitSHAPattern = regexp.MustCompile(`^[0-9a-f]{7,40}$`)
+var revisionPattern = regexp.MustCompile(`^[0-9]+$`)
+
+func parseRollbackTime(s string) (time.Time, bool) {
+	for _, layout := range rollbackTimeLayouts {
+		if t, err := time.ParseInLocation(layout, s, timezone); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// resolveRollbackTarget resolves the rollback target in the family of the current task definition.
+// "to" accepts a revision, a task definition arn (or family:revision), a git sha recorded at deploy or a timestamp.
+// An all-digit git sha is looked up before it's read as a revision, and "sha:" forces the git sha.
+func (a *App) resolveRollbackTarget(ctx context.Context, currentArn string, to string) (string, error) {
+	if to == "" {
+		return a.FindRollbackTarget(ctx, currentArn)
+	}
+
+	family := taskDefinitionFamily(currentArn)
+	findBySHA := func(sha string) (string, error) {
+		return a.FindTaskDefinition(ctx, family, func(td *ecs.TaskDefinition, tags []*ecs.Tag) bool {
+			return strings.HasPrefix(tagValue(tags, tagGitSHA), sha)
+		})
+	}
+
+	if strings.HasPrefix(to, "sha:") {
+		sha := strings.TrimPrefix(to, "sha:")
+		if !gitSHAPattern.MatchString(sha) {
+			return "", fmt.Errorf("invalid git sha %s", sha)
+		}
+		return findBySHA(sha)
+	}
+
+	if t, ok := parseRollbackTime(to); ok {
+		return a.FindTaskDefinition(ctx, family, func(td *ecs.TaskDefinition, tags []*ecs.Tag) bool {
+			return td.RegisteredAt != nil && !td.RegisteredAt.After(t)
+		})
+	}
+
+	var name string
+	if revisionPattern.MatchString(to) {
+		if gitSHAPattern.MatchString(to) {
+			arn, err := findBySHA(to)
+			if err == nil {
+				return arn, nil
+			}
+			if !errors.Is(err, errTaskDefinitionNotFound) {
+				return "", err
+			}
+		}
+		name = fmt.Sprintf("%s:%s", family, to)
+	} else if strings.HasPrefix(to, "arn:") || strings.Contains(to, ":") {
+		if taskDefinitionFamily(to) != family {
+			return "", fmt.Errorf("%s is not a revision of %s", to, family)
+		}
+		name = to
+	} else if gitSHAPattern.MatchString(to) {
+		return findBySHA(to)
+	} else {
+		return "", fmt.Errorf("invalid rollback target %s", to)
+	}
+
+	td, err := a.DescribeTaskDefinition(ctx, name)
+	if err != nil {
+		return "", err
+	}
+	return *td.TaskDefinitionArn, nil
 }
 
 func (a *App) Rollback(ctx context.Context, opt RollbackOption) error {
+	if !opt.DryRun {
+		release, err := a.acquireLock(ctx, "rollback", opt.WaitForLock)
+		if err != nil {
+			return err
+		}
+		defer release()
+	}
+
+	startedAt := time.Now()
+	revisions := []NotificationRevision{}
+	err := a.rollback(ctx, opt, &revisions)
+	if !opt.DryRun {
+		a.notify(Notification{
+			Event:     NotifyRollback,
+			Revisions: revisions,
+			Duration:  time.Since(startedAt).Seconds(),
+			Error:     errorString(err),
+		})
+	}
+	return err
+}
+
+func (a *App) rollback(ctx context.Context, opt RollbackOption, revisions *[]NotificationRevision) error {
 	a.Log("Starting rollback")
 
 	err := a.ResolveConfigStack(Params{})
 	if err != nil {
 		return err
 	}
-	srvNames := []*string{}
-	for name := range a.def.nameToSrv {
-		srvNames = append(srvNames, aws.String(a.resolveFullName(name)))
+	names, err := a.selectServices(opt.Services, opt.ExcludeServices)
+	if err != nil {
+		return err
 	}
-	desc, err := a.DescribeServices(ctx, srvNames)
+	desc, err := a.DescribeServices(ctx, a.serviceFullNames(names))
 	if err != nil {
 		return err
 	}
 
+	// the other deployment controllers own the task definitions of their services
+	services := []*ecs.Service{}
+	srvNames := []*string{}
 	for _, s := range desc.Services {
+		switch {
+		case isCodeDeployService(*s):
+			a.Log(color.YellowString("Skip service with the CODE_DEPLOY deployment controller, roll it back with CodeDeploy:"), LogTarget(*s.ServiceName))
+		case isExternalService(*s) || s.TaskDefinition == nil:
+			a.Log(color.YellowString("Skip service with task sets, use abort for canary task sets:"), LogTarget(*s.ServiceName))
+		default:
+			services = append(services, s)
+			srvNames = append(srvNames, s.ServiceName)
+		}
+	}
+	if len(services) == 0 {
+		a.Log("Nothing to rollback")
+		return nil
+	}
+
+	// resolve all targets before any changes
+	targets := map[string]string{}
+	for _, s := range services {
 		currentArn := *s.TaskDefinition
-		targetArn, err := a.FindRollbackTarget(ctx, currentArn)
+		targetArn, err := a.resolveRollbackTarget(ctx, currentArn, opt.To)
 		if err != nil {
-			return errors.Wrap(err, "failed to find rollback target")
+			return errors.Wrapf(err, "failed to find rollback target of %s", *s.ServiceName)
 		}
+		targets[*s.ServiceName] = targetArn
+		*revisions = append(*revisions, NotificationRevision{
+			Service: *s.ServiceName,
+			From:    arnToName(currentArn),
+			To:      arnToName(targetArn),
+		})
+	}
 
+	for _, s := range services {
+		currentArn := *s.TaskDefinition
 		fullname := *s.ServiceName
+		targetArn := targets[fullname]
 
 		if opt.DryRun {
-			color.YellowString("~ rollback task definition: service=%s task definition=%s", fullname, arnToName(targetArn))
+			color.Yellow("~ rollback task definition: service=%s task definition=%s -> %s", fullname, arnToName(currentArn), arnToName(targetArn))
+			currTd, err := a.DescribeTaskDefinition(ctx, currentArn)
+			if err != nil {
+				return err
+			}
+			targetTd, err := a.DescribeTaskDefinition(ctx, targetArn)
+			if err != nil {
+				return err
+			}
+			d, err := diffTaskDefinition(*currTd, *targetTd)
+			if err != nil {
+				return err
+			}
+			fmt.Println(d)
 		} else {
 			f := false // Set ForceNewDeployment and UpdateService to false
 			a.Log("rollbacking", LogTarget(arnToName(currentArn)), "->", LogTarget(arnToName(targetArn)))
@@ -66,14 +226,14 @@ func (a *App) Rollback(ctx context.Context, opt RollbackOption) error {
 	time.Sleep(delayForServiceChanged) // wait for service updated
 
 	if !opt.DryRun {
-		if err := a.WaitServiceStable(ctx, time.Now(), srvNames); err != nil {
+		if err := a.WaitServiceStable(ctx, time.Now(), srvNames, WaitOption{Timeout: opt.Timeout}); err != nil {
 			return errors.Wrap(err, "failed to wait service stable")
 		}
 		a.Log("Service is stable now. Completed!")
 	}
 
 	if opt.DeregisterTaskDefinition {
-		for _, s := range desc.Services {
+		for _, s := range services {
 			currentArn := *s.TaskDefinition
 
 			if opt.DryRun {
@@ -91,3 +251,98 @@ func (a *App) Rollback(ctx context.Context, opt RollbackOption) error {
 
 	return nil
 }
+
+func (a *App) snapshotServices(ctx context.Context, srvNames []*string) ([]serviceSnapshot, error) {
+	desc, err := a.DescribeServices(ctx, srvNames)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshots := []serviceSnapshot{}
+	for _, s := range desc.Services {
+		// services with task sets have no task definition
+		if *s.Status != "ACTIVE" || s.TaskDefinition == nil {
+			continue
+		}
+		// updating the task definition is rejected, CodeDeploy rolls back its deployments
+		if isCodeDeployService(*s) {
+			a.DebugLog("skip snapshot of CODE_DEPLOY service", LogTarget(*s.ServiceName))
+			continue
+		}
+		desiredCount := s.DesiredCount
+		// autoscaling owns the desired count
+		if a.def.nameToSrv[a.resolveKeyName(*s.ServiceName)].autoScaling != nil {
+			desiredCount = nil
+		}
+		snapshots = append(snapshots, serviceSnapshot{
+			name:           *s.ServiceName,
+			taskDefinition: *s.TaskDefinition,
+			desiredCount:   desiredCount,
+		})
+	}
+	return snapshots, nil
+}
+
+// autoRollback reverts services changed by the failed deploy to the snapshots.
+func (a *App) autoRollback(opt DeployOption, snapshots []serviceSnapshot, deployErr error) error {
+	a.Log(color.RedString("Deploy failed:"), deployErr)
+	a.Log("Starting auto rollback")
+
+	ctx := cleanupContext()
+	if opt.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opt.Timeout)
+		defer cancel()
+	}
+
+	startedAt := time.Now()
+	reverted := []*string{}
+	reports := []string{}
+	revisions := []NotificationRevision{}
+	for _, snap := range snapshots {
+		curr, err := a.DescribeService(ctx, aws.String(snap.name))
+		if err != nil {
+			return fmt.Errorf("deploy failed: %v, and failed to rollback: %w", deployErr, err)
+		}
+		if *curr.TaskDefinition == snap.taskDefinition {
+			continue
+		}
+
+		f := false
+		a.Log("rollbacking", LogTarget(arnToName(*curr.TaskDefinition)), "->", LogTarget(arnToName(snap.taskDefinition)))
+		if err := a.UpdateServiceTask(ctx, snap.name, snap.taskDefinition, snap.desiredCount, &f); err != nil {
+			return fmt.Errorf("deploy failed: %v, and failed to rollback: %w", deployErr, err)
+		}
+		reverted = append(reverted, aws.String(snap.name))
+		reports = append(reports, fmt.Sprintf("%s (%s -> %s)", snap.name, arnToName(*curr.TaskDefinition), arnToName(snap.taskDefinition)))
+		revisions = append(revisions, NotificationRevision{
+			Service: snap.name,
+			From:    arnToName(*curr.TaskDefinition),
+			To:      arnToName(snap.taskDefinition),
+		})
+	}
+
+	if len(reverted) == 0 {
+		return fmt.Errorf("deploy failed: %w. no services to rollback", deployErr)
+	}
+
+	if err := a.WaitServiceStable(ctx, time.Now(), reverted, opt.waitOption()); err != nil {
+		a.notify(Notification{
+			Event:     NotifyRollback,
+			Revisions: revisions,
+			Duration:  time.Since(startedAt).Seconds(),
+			Error:     err.Error(),
+		})
+		return fmt.Errorf("deploy failed: %v, and rollbacked services are not stable: %w", deployErr, err)
+	}
+	a.notify(Notification{
+		Event:     NotifyRollback,
+		Revisions: revisions,
+		Duration:  time.Since(startedAt).Seconds(),
+	})
+
+	for _, r := range reports {
+		a.Log(LogDone(), "Rollbacked", LogTarget(r))
+	}
+	return fmt.Errorf("deploy failed and rollbacked %s: %w", strings.Join(reports, ", "), deployErr)
+}
@@ -34,7 +34,54 @@ func containerOf(td *ecs.TaskDefinition, name *string) *ecs.ContainerDefinition
 	return nil
 }
 
+func (a *App) taskOverride(container *ecs.ContainerDefinition, overrides string, command []string) (*ecs.TaskOverride, error) {
+	var ov ecs.TaskOverride
+	if overrides != "" {
+		if err := json.Unmarshal([]byte(overrides), &ov); err != nil {
+			return nil, fmt.Errorf("invalid overrides: %w", err)
+		}
+	}
+	if command != nil {
+		a.Log("command", LogTarget(command))
+		cmd := aws.StringSlice(command)
+		ov.ContainerOverrides = []*ecs.ContainerOverride{
+			{
+				Name:    container.Name,
+				Command: cmd,
+			},
+		}
+	}
+	return &ov, nil
+}
+
+func (a *App) runTaskAndWait(ctx context.Context, srv ecs.Service, tdArn string, container *ecs.ContainerDefinition, count int64, ov *ecs.TaskOverride, noWait bool) error {
+	task, err := a.RunTask(ctx, srv, tdArn, count, ov)
+	if err != nil {
+		return err
+	}
+
+	if !noWait {
+		if err := a.WaitRunTask(ctx, task, container, time.Now()); err != nil {
+			return fmt.Errorf("failed to run task: %w", err)
+		}
+	}
+
+	return a.DescribeTaskStatus(ctx, task, container)
+}
+
 func (a *App) Run(ctx context.Context, name string, opt RunOption) error {
+	startedAt := time.Now()
+	err := a.run(ctx, name, opt)
+	a.notify(Notification{
+		Event:    NotifyRun,
+		Services: []string{a.resolveFullName(name)},
+		Duration: time.Since(startedAt).Seconds(),
+		Error:    errorString(err),
+	})
+	return err
+}
+
+func (a *App) run(ctx context.Context, name string, opt RunOption) error {
 	a.Log("base service", LogTarget(name))
 	err := a.ResolveConfigStack(opt.AdditionalParams)
 	if err != nil {
@@ -66,7 +113,7 @@ func (a *App) Run(ctx context.Context, name string, opt RunOption) error {
 		if err != nil {
 			return err
 		}
-		newTd, err := a.RegisterTaskDefinition(ctx, &td)
+		newTd, err := a.RegisterTaskDefinition(ctx, &td, nil)
 		if err != nil {
 			return err
 		}
@@ -83,37 +130,12 @@ func (a *App) Run(ctx context.Context, name string, opt RunOption) error {
 
 	a.Log("container", LogTarget(*container.Name))
 
-	count := opt.Count
-
-	var ov ecs.TaskOverride
-	if ovStr := opt.Overrides; ovStr != "" {
-		if err := json.Unmarshal([]byte(ovStr), &ov); err != nil {
-			return fmt.Errorf("invalid overrides: %w", err)
-		}
-	}
-	if opt.Command != nil {
-		a.Log("command", LogTarget(opt.Command))
-		cmd := aws.StringSlice(opt.Command)
-		ov.ContainerOverrides = []*ecs.ContainerOverride{
-			{
-				Name:    container.Name,
-				Command: cmd,
-			},
-		}
-	}
-
-	task, err := a.RunTask(ctx, *srv, *tdArn, count, &ov)
+	ov, err := a.taskOverride(container, opt.Overrides, opt.Command)
 	if err != nil {
 		return err
 	}
 
-	if !opt.NoWait {
-		if err := a.WaitRunTask(ctx, task, container, time.Now()); err != nil {
-			return fmt.Errorf("failed to run task: %w", err)
-		}
-	}
-
-	if err := a.DescribeTaskStatus(ctx, task, container); err != nil {
+	if err := a.runTaskAndWait(ctx, *srv, *tdArn, container, opt.Count, ov, opt.NoWait); err != nil {
 		return err
 	}
 
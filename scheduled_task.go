@@ -0,0 +1,392 @@
+package ecsceed
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/private/protocol/json/jsonutil"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/aws/aws-sdk-go/service/eventbridge"
+	"github.com/fatih/color"
+	"github.com/kylelemons/godebug/diff"
+)
+
+// id of the rule target put by ecsceed
+const scheduledTaskTargetID = "ecsceed"
+
+// scheduledTaskDefinition is the rule and target of a scheduled task in a comparable form
+type scheduledTaskDefinition struct {
+	Rule   *eventbridge.PutRuleInput
+	Target *eventbridge.Target
+}
+
+func validateScheduledTask(st ConfigScheduledTask, nameToTd map[string]ecs.TaskDefinition, nameToSrv map[string]Service) error {
+	if st.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if _, ok := nameToTd[st.TaskDefinition]; !ok {
+		return fmt.Errorf("task definition %s is undefined", st.TaskDefinition)
+	}
+	if !strings.HasPrefix(st.Schedule, "rate(") && !strings.HasPrefix(st.Schedule, "cron(") {
+		return fmt.Errorf("invalid schedule %q. use rate(...) or cron(...)", st.Schedule)
+	}
+	if st.RoleARN == "" {
+		return fmt.Errorf("role_arn is required")
+	}
+	if st.Service != "" {
+		if _, ok := nameToSrv[st.Service]; !ok {
+			return fmt.Errorf("service %s is undefined", st.Service)
+		}
+	}
+	if st.Count != nil && *st.Count < 1 {
+		return fmt.Errorf("count must be at least 1")
+	}
+	if st.NetworkConfiguration != nil && len(st.NetworkConfiguration.Subnets) == 0 {
+		return fmt.Errorf("network_configuration requires subnets")
+	}
+	if st.Overrides != "" {
+		var ov ecs.TaskOverride
+		if err := json.Unmarshal([]byte(st.Overrides), &ov); err != nil {
+			return fmt.Errorf("invalid overrides: %w", err)
+		}
+	}
+	return nil
+}
+
+func scheduledTaskRule(ruleName string, st ConfigScheduledTask) *eventbridge.PutRuleInput {
+	state := eventbridge.RuleStateEnabled
+	if st.Disabled {
+		state = eventbridge.RuleStateDisabled
+	}
+	rule := &eventbridge.PutRuleInput{
+		Name:               aws.String(ruleName),
+		ScheduleExpression: aws.String(st.Schedule),
+		State:              aws.String(state),
+	}
+	if st.Description != "" {
+		rule.Description = aws.String(st.Description)
+	}
+	return rule
+}
+
+// scheduledTaskTarget builds the ECS target of the rule.
+// Launch and network settings are copied from the service, and the explicit ones override them.
+func scheduledTaskTarget(st ConfigScheduledTask, srv *ecs.Service, clusterArn string, tdArn string) (*eventbridge.Target, error) {
+	params := &eventbridge.EcsParameters{
+		TaskDefinitionArn: aws.String(tdArn),
+		TaskCount:         aws.Int64(1),
+	}
+	if srv != nil {
+		params.LaunchType = srv.LaunchType
+		params.PlatformVersion = srv.PlatformVersion
+		if nc := srv.NetworkConfiguration; nc != nil && nc.AwsvpcConfiguration != nil {
+			params.NetworkConfiguration = &eventbridge.NetworkConfiguration{
+				AwsvpcConfiguration: &eventbridge.AwsVpcConfiguration{
+					Subnets:        nc.AwsvpcConfiguration.Subnets,
+					SecurityGroups: nc.AwsvpcConfiguration.SecurityGroups,
+					AssignPublicIp: nc.AwsvpcConfiguration.AssignPublicIp,
+				},
+			}
+		}
+	}
+	if st.LaunchType != "" {
+		params.LaunchType = aws.String(st.LaunchType)
+	}
+	if st.PlatformVersion != "" {
+		params.PlatformVersion = aws.String(st.PlatformVersion)
+	}
+	if nc := st.NetworkConfiguration; nc != nil {
+		vpc := &eventbridge.AwsVpcConfiguration{
+			Subnets: aws.StringSlice(nc.Subnets),
+		}
+		if len(nc.SecurityGroups) > 0 {
+			vpc.SecurityGroups = aws.StringSlice(nc.SecurityGroups)
+		}
+		if nc.AssignPublicIP != "" {
+			vpc.AssignPublicIp = aws.String(nc.AssignPublicIP)
+		}
+		params.NetworkConfiguration = &eventbridge.NetworkConfiguration{AwsvpcConfiguration: vpc}
+	}
+	if st.Count != nil {
+		params.TaskCount = st.Count
+	}
+	if st.Group != "" {
+		params.Group = aws.String(st.Group)
+	}
+
+	target := &eventbridge.Target{
+		Id:            aws.String(scheduledTaskTargetID),
+		Arn:           aws.String(clusterArn),
+		RoleArn:       aws.String(st.RoleARN),
+		EcsParameters: params,
+	}
+	if st.Overrides != "" {
+		var ov ecs.TaskOverride
+		if err := json.Unmarshal([]byte(st.Overrides), &ov); err != nil {
+			return nil, fmt.Errorf("invalid overrides: %w", err)
+		}
+		b, err := jsonutil.BuildJSON(&ov)
+		if err != nil {
+			return nil, err
+		}
+		target.Input = aws.String(string(b))
+	}
+	return target, nil
+}
+
+func eventBridgeTags(tags []*ecs.Tag) []*eventbridge.Tag {
+	dst := []*eventbridge.Tag{}
+	for _, t := range tags {
+		dst = append(dst, &eventbridge.Tag{Key: t.Key, Value: t.Value})
+	}
+	return dst
+}
+
+// listRuleTargets lists all targets of the rule following the next tokens
+func (a *App) listRuleTargets(ctx context.Context, ruleName string) ([]*eventbridge.Target, error) {
+	targets := []*eventbridge.Target{}
+	in := &eventbridge.ListTargetsByRuleInput{
+		Rule: aws.String(ruleName),
+	}
+	for {
+		out, err := a.events.ListTargetsByRuleWithContext(ctx, in)
+		if err != nil {
+			return nil, err
+		}
+		targets = append(targets, out.Targets...)
+		if out.NextToken == nil {
+			return targets, nil
+		}
+		in.NextToken = out.NextToken
+	}
+}
+
+// describeScheduledTask returns the rule and target of the scheduled task, or nil if the rule doesn't exist
+func (a *App) describeScheduledTask(ctx context.Context, ruleName string) (*scheduledTaskDefinition, error) {
+	out, err := a.events.DescribeRuleWithContext(ctx, &eventbridge.DescribeRuleInput{
+		Name: aws.String(ruleName),
+	})
+	if err != nil {
+		if awsErr, ok := err.(awserr.Error); ok && awsErr.Code() == eventbridge.ErrCodeResourceNotFoundException {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to describe rule %s: %w", ruleName, err)
+	}
+
+	def := &scheduledTaskDefinition{
+		Rule: &eventbridge.PutRuleInput{
+			Name:               out.Name,
+			Description:        out.Description,
+			ScheduleExpression: out.ScheduleExpression,
+			State:              out.State,
+		},
+	}
+	targets, err := a.listRuleTargets(ctx, ruleName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list targets of rule %s: %w", ruleName, err)
+	}
+	for _, t := range targets {
+		if equalString(t.Id, scheduledTaskTargetID) {
+			def.Target = t
+		}
+	}
+	return def, nil
+}
+
+func diffScheduledTask(curr *scheduledTaskDefinition, next *scheduledTaskDefinition) (string, error) {
+	currBytes, err := MarshalJSON(curr)
+	if err != nil {
+		return "", err
+	}
+	nextBytes, err := MarshalJSON(next)
+	if err != nil {
+		return "", err
+	}
+	return diff.Diff(string(currBytes), string(nextBytes)), nil
+}
+
+// deployScheduledTasks points the rules of the scheduled tasks at the registered task definitions
+func (a *App) deployScheduledTasks(ctx context.Context, opt DeployOption, tdNames []string, nameToTdArn map[string]string) error {
+	registered := map[string]bool{}
+	for _, name := range tdNames {
+		registered[name] = true
+	}
+	names := []string{}
+	for _, name := range a.def.scheduledTaskNames {
+		if registered[a.def.nameToScheduledTask[name].TaskDefinition] {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return nil
+	}
+
+	cluster, err := a.DescribeCluster(ctx, a.def.cluster)
+	if err != nil {
+		return err
+	}
+	if cluster == nil {
+		return fmt.Errorf("cluster %s is not found", a.def.cluster)
+	}
+
+	for _, name := range names {
+		st := a.def.nameToScheduledTask[name]
+		ruleName := a.resolveFullName(name)
+
+		tdArn, ok := nameToTdArn[st.TaskDefinition]
+		if !ok {
+			// not registered on dry run
+			tdArn = a.resolveFullName(st.TaskDefinition)
+		}
+		var srv *ecs.Service
+		if st.Service != "" {
+			s := a.def.nameToSrv[st.Service].srv
+			srv = &s
+		}
+		target, err := scheduledTaskTarget(st, srv, *cluster.ClusterArn, tdArn)
+		if err != nil {
+			return fmt.Errorf("scheduled task %s: %w", name, err)
+		}
+		next := &scheduledTaskDefinition{
+			Rule:   scheduledTaskRule(ruleName, st),
+			Target: target,
+		}
+
+		curr, err := a.describeScheduledTask(ctx, ruleName)
+		if err != nil {
+			return err
+		}
+
+		if opt.DryRun {
+			if curr == nil {
+				color.Yellow("+ scheduled task: %s", ruleName)
+				PrintJSON(next)
+			} else {
+				color.Green("~ scheduled task: %s", ruleName)
+				d, err := diffScheduledTask(curr, next)
+				if err != nil {
+					return err
+				}
+				fmt.Println(d)
+			}
+			continue
+		}
+
+		rule := *next.Rule
+		rule.Tags = eventBridgeTags(opt.serviceTags)
+		ruleOut, err := a.events.PutRuleWithContext(ctx, &rule)
+		if err != nil {
+			return fmt.Errorf("failed to put rule %s: %w", ruleName, err)
+		}
+		// tags of PutRule are applied only on create, and prune finds the rules by them
+		if _, err := a.events.TagResourceWithContext(ctx, &eventbridge.TagResourceInput{
+			ResourceARN: ruleOut.RuleArn,
+			Tags:        rule.Tags,
+		}); err != nil {
+			return fmt.Errorf("failed to tag rule %s: %w", ruleName, err)
+		}
+		out, err := a.events.PutTargetsWithContext(ctx, &eventbridge.PutTargetsInput{
+			Rule:    aws.String(ruleName),
+			Targets: []*eventbridge.Target{next.Target},
+		})
+		if err != nil {
+			return fmt.Errorf("failed to put target of rule %s: %w", ruleName, err)
+		}
+		if aws.Int64Value(out.FailedEntryCount) > 0 {
+			return fmt.Errorf("failed to put target of rule %s: %s", ruleName, aws.StringValue(out.FailedEntries[0].ErrorMessage))
+		}
+		a.Log(LogDone(), "Scheduled task", LogTarget(ruleName), "->", LogTarget(arnToName(tdArn)))
+	}
+	return nil
+}
+
+// deleteScheduledTask removes the targets of the rule and deletes it
+func (a *App) deleteScheduledTask(ctx context.Context, ruleName string) error {
+	targets, err := a.listRuleTargets(ctx, ruleName)
+	if err != nil {
+		return err
+	}
+	// RemoveTargets accepts up to 100 ids at once
+	for len(targets) > 0 {
+		n := len(targets)
+		if n > 100 {
+			n = 100
+		}
+		ids := []*string{}
+		for _, t := range targets[:n] {
+			ids = append(ids, t.Id)
+		}
+		if _, err := a.events.RemoveTargetsWithContext(ctx, &eventbridge.RemoveTargetsInput{
+			Rule: aws.String(ruleName),
+			Ids:  ids,
+		}); err != nil {
+			return err
+		}
+		targets = targets[n:]
+	}
+	_, err = a.events.DeleteRuleWithContext(ctx, &eventbridge.DeleteRuleInput{
+		Name: aws.String(ruleName),
+	})
+	return err
+}
+
+// findPrunableScheduledTasks lists the rules of the scheduled tasks managed by the overlay which are removed from config
+func (a *App) findPrunableScheduledTasks(ctx context.Context) ([]string, error) {
+	inConfig := map[string]bool{}
+	for _, name := range a.def.scheduledTaskNames {
+		inConfig[a.resolveFullName(name)] = true
+	}
+
+	rules := []string{}
+	in := &eventbridge.ListRulesInput{}
+	if a.def.namePrefix != "" {
+		in.NamePrefix = aws.String(a.def.namePrefix)
+	}
+	for {
+		out, err := a.events.ListRulesWithContext(ctx, in)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list rules: %w", err)
+		}
+		for _, r := range out.Rules {
+			name := *r.Name
+			if inConfig[name] || r.ManagedBy != nil || !strings.HasSuffix(name, a.def.nameSuffix) {
+				continue
+			}
+			tout, err := a.events.ListTagsForResourceWithContext(ctx, &eventbridge.ListTagsForResourceInput{
+				ResourceARN: r.Arn,
+			})
+			if err != nil {
+				return nil, fmt.Errorf("failed to list tags of rule %s: %w", name, err)
+			}
+			tags := []*ecs.Tag{}
+			for _, t := range tout.Tags {
+				tags = append(tags, &ecs.Tag{Key: t.Key, Value: t.Value})
+			}
+			if a.isManaged(tags) {
+				rules = append(rules, name)
+			}
+		}
+		if out.NextToken == nil {
+			return rules, nil
+		}
+		in.NextToken = out.NextToken
+	}
+}
+
+// scheduledTaskDefinitionsInUse collects the task definitions of the rules of the scheduled tasks
+func (a *App) scheduledTaskDefinitionsInUse(ctx context.Context, inUse map[string]bool) error {
+	for _, name := range a.def.scheduledTaskNames {
+		def, err := a.describeScheduledTask(ctx, a.resolveFullName(name))
+		if err != nil {
+			return err
+		}
+		if def != nil && def.Target != nil && def.Target.EcsParameters != nil {
+			inUse[*def.Target.EcsParameters.TaskDefinitionArn] = true
+		}
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package ecsceed
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateScheduledTask(t *testing.T) {
+	nameToTd := map[string]ecs.TaskDefinition{"batch": {}}
+	nameToSrv := map[string]Service{"api": {}}
+	valid := ConfigScheduledTask{
+		Name:           "report",
+		TaskDefinition: "batch",
+		Schedule:       "cron(0 3 * * ? *)",
+		RoleARN:        "arn:aws:iam::123456789012:role/ecsEventsRole",
+		Service:        "api",
+	}
+	assert.NoError(t, validateScheduledTask(valid, nameToTd, nameToSrv))
+
+	invalids := []func(st *ConfigScheduledTask){
+		func(st *ConfigScheduledTask) { st.TaskDefinition = "missing" },
+		func(st *ConfigScheduledTask) { st.Schedule = "every day" },
+		func(st *ConfigScheduledTask) { st.RoleARN = "" },
+		func(st *ConfigScheduledTask) { st.Service = "missing" },
+		func(st *ConfigScheduledTask) { st.Count = aws.Int64(0) },
+		func(st *ConfigScheduledTask) { st.Overrides = "{" },
+		func(st *ConfigScheduledTask) { st.NetworkConfiguration = &ConfigNetworkConfiguration{} },
+	}
+	for _, f := range invalids {
+		st := valid
+		f(&st)
+		assert.Error(t, validateScheduledTask(st, nameToTd, nameToSrv))
+	}
+}
+
+func TestScheduledTaskRule(t *testing.T) {
+	rule := scheduledTaskRule("dev-report", ConfigScheduledTask{Schedule: "rate(1 hour)"})
+	assert.Equal(t, "dev-report", *rule.Name)
+	assert.Equal(t, "ENABLED", *rule.State)
+	assert.Nil(t, rule.Description)
+
+	rule = scheduledTaskRule("dev-report", ConfigScheduledTask{Schedule: "rate(1 hour)", Disabled: true, Description: "daily report"})
+	assert.Equal(t, "DISABLED", *rule.State)
+	assert.Equal(t, "daily report", *rule.Description)
+}
+
+func TestScheduledTaskTarget(t *testing.T) {
+	srv := &ecs.Service{
+		LaunchType:      aws.String("FARGATE"),
+		PlatformVersion: aws.String("1.4.0"),
+		NetworkConfiguration: &ecs.NetworkConfiguration{
+			AwsvpcConfiguration: &ecs.AwsVpcConfiguration{
+				Subnets:        aws.StringSlice([]string{"subnet-1"}),
+				SecurityGroups: aws.StringSlice([]string{"sg-1"}),
+				AssignPublicIp: aws.String("DISABLED"),
+			},
+		},
+	}
+	st := ConfigScheduledTask{
+		RoleARN:   "arn:aws:iam::123456789012:role/ecsEventsRole",
+		Count:     aws.Int64(2),
+		Overrides: `{"containerOverrides":[{"name":"app","command":["report"]}]}`,
+	}
+	target, err := scheduledTaskTarget(st, srv, "arn:aws:ecs:ap-northeast-1:123456789012:cluster/default", "arn:aws:ecs:ap-northeast-1:123456789012:task-definition/batch:3")
+	assert.NoError(t, err)
+	assert.Equal(t, scheduledTaskTargetID, *target.Id)
+	assert.Equal(t, "arn:aws:ecs:ap-northeast-1:123456789012:cluster/default", *target.Arn)
+	assert.Equal(t, "FARGATE", *target.EcsParameters.LaunchType)
+	assert.Equal(t, int64(2), *target.EcsParameters.TaskCount)
+	assert.Equal(t, []string{"subnet-1"}, aws.StringValueSlice(target.EcsParameters.NetworkConfiguration.AwsvpcConfiguration.Subnets))
+	assert.JSONEq(t, `{"containerOverrides":[{"name":"app","command":["report"]}]}`, *target.Input)
+
+	// explicit settings override the service
+	st = ConfigScheduledTask{
+		RoleARN:    "arn:aws:iam::123456789012:role/ecsEventsRole",
+		LaunchType: "EC2",
+		NetworkConfiguration: &ConfigNetworkConfiguration{
+			Subnets: []string{"subnet-2"},
+		},
+	}
+	target, err = scheduledTaskTarget(st, srv, "arn:aws:ecs:ap-northeast-1:123456789012:cluster/default", "batch")
+	assert.NoError(t, err)
+	assert.Equal(t, "EC2", *target.EcsParameters.LaunchType)
+	assert.Equal(t, int64(1), *target.EcsParameters.TaskCount)
+	assert.Equal(t, []string{"subnet-2"}, aws.StringValueSlice(target.EcsParameters.NetworkConfiguration.AwsvpcConfiguration.Subnets))
+	assert.Nil(t, target.EcsParameters.NetworkConfiguration.AwsvpcConfiguration.SecurityGroups)
+	assert.Nil(t, target.Input)
+}
@@ -0,0 +1,382 @@
+package ecsceed
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/aws/aws-sdk-go/service/servicediscovery"
+	"github.com/fatih/color"
+)
+
+const defaultServiceDiscoveryTTL = 60
+
+var serviceDiscoveryPollInterval = 5 * time.Second
+
+func validateServiceDiscovery(srv Service) error {
+	c := srv.serviceDiscovery
+	if c == nil {
+		return nil
+	}
+	if c.Namespace == "" {
+		return fmt.Errorf("service_discovery requires namespace")
+	}
+	if len(srv.srv.ServiceRegistries) > 0 {
+		return fmt.Errorf("serviceRegistries in the service file conflicts with service_discovery")
+	}
+	switch serviceDiscoveryRecordType(c) {
+	case servicediscovery.RecordTypeA:
+	case servicediscovery.RecordTypeSrv:
+		if c.ContainerName == "" || c.ContainerPort == nil {
+			return fmt.Errorf("service_discovery with SRV records requires container_name and container_port")
+		}
+	default:
+		return fmt.Errorf("invalid service_discovery record_type %s. use A or SRV", c.RecordType)
+	}
+	if c.TTL != nil && *c.TTL < 0 {
+		return fmt.Errorf("invalid service_discovery ttl %d", *c.TTL)
+	}
+	// Cloud Map deprecated the failure threshold and always uses 1
+	if c.HealthCheck != nil && c.HealthCheck.FailureThreshold != 0 && c.HealthCheck.FailureThreshold != 1 {
+		return fmt.Errorf("service_discovery health_check failure_threshold must be 1. Cloud Map always uses 1")
+	}
+	return nil
+}
+
+func serviceDiscoveryRecordType(c *ConfigServiceDiscovery) string {
+	if c.RecordType == "" {
+		return servicediscovery.RecordTypeA
+	}
+	return strings.ToUpper(c.RecordType)
+}
+
+// serviceDiscoveryName is the Cloud Map service name, the full name of the service by default
+// so that overlays sharing a namespace don't collide.
+func (a *App) serviceDiscoveryName(name string, c *ConfigServiceDiscovery) string {
+	if c.Name != "" {
+		return c.Name
+	}
+	return a.resolveFullName(name)
+}
+
+func serviceDiscoveryDNSRecords(c *ConfigServiceDiscovery) []*servicediscovery.DnsRecord {
+	ttl := int64(defaultServiceDiscoveryTTL)
+	if c.TTL != nil {
+		ttl = *c.TTL
+	}
+	return []*servicediscovery.DnsRecord{
+		{Type: aws.String(serviceDiscoveryRecordType(c)), TTL: aws.Int64(ttl)},
+	}
+}
+
+func serviceDiscoveryCreateInput(name string, namespaceID string, c *ConfigServiceDiscovery) *servicediscovery.CreateServiceInput {
+	in := &servicediscovery.CreateServiceInput{
+		Name:        aws.String(name),
+		NamespaceId: aws.String(namespaceID),
+		DnsConfig: &servicediscovery.DnsConfig{
+			DnsRecords:    serviceDiscoveryDNSRecords(c),
+			RoutingPolicy: aws.String(serviceDiscoveryRoutingPolicy(c)),
+		},
+	}
+	if c.HealthCheck != nil {
+		in.HealthCheckCustomConfig = &servicediscovery.HealthCheckCustomConfig{
+			FailureThreshold: aws.Int64(1),
+		}
+	}
+	return in
+}
+
+// equalDNSRecords compares the records regardless of the order
+func equalDNSRecords(a []*servicediscovery.DnsRecord, b []*servicediscovery.DnsRecord) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	ttls := map[string]int64{}
+	for _, r := range a {
+		ttls[*r.Type] = *r.TTL
+	}
+	for _, r := range b {
+		if ttl, ok := ttls[*r.Type]; !ok || ttl != *r.TTL {
+			return false
+		}
+	}
+	return true
+}
+
+func serviceRegistry(arn string, c *ConfigServiceDiscovery) *ecs.ServiceRegistry {
+	r := &ecs.ServiceRegistry{RegistryArn: aws.String(arn)}
+	if serviceDiscoveryRecordType(c) == servicediscovery.RecordTypeSrv {
+		r.ContainerName = aws.String(c.ContainerName)
+		r.ContainerPort = c.ContainerPort
+	}
+	return r
+}
+
+// resolveNamespaceID accepts a namespace id or name
+func (a *App) resolveNamespaceID(ctx context.Context, namespace string) (string, error) {
+	if strings.HasPrefix(namespace, "ns-") {
+		return namespace, nil
+	}
+	var id string
+	err := a.serviceDiscovery.ListNamespacesPagesWithContext(ctx, &servicediscovery.ListNamespacesInput{},
+		func(out *servicediscovery.ListNamespacesOutput, lastPage bool) bool {
+			for _, ns := range out.Namespaces {
+				if *ns.Name == namespace {
+					id = *ns.Id
+					return false
+				}
+			}
+			return true
+		},
+	)
+	if err != nil {
+		return "", fmt.Errorf("failed to list namespaces: %w", err)
+	}
+	if id == "" {
+		return "", fmt.Errorf("namespace %s is not found", namespace)
+	}
+	return id, nil
+}
+
+// findDiscoveryService returns the Cloud Map service in the namespace, or nil if it doesn't exist
+func (a *App) findDiscoveryService(ctx context.Context, namespaceID string, name string) (*servicediscovery.ServiceSummary, error) {
+	var found *servicediscovery.ServiceSummary
+	err := a.serviceDiscovery.ListServicesPagesWithContext(ctx,
+		&servicediscovery.ListServicesInput{
+			Filters: []*servicediscovery.ServiceFilter{
+				{
+					Name:      aws.String(servicediscovery.ServiceFilterNameNamespaceId),
+					Condition: aws.String(servicediscovery.FilterConditionEq),
+					Values:    aws.StringSlice([]string{namespaceID}),
+				},
+			},
+		},
+		func(out *servicediscovery.ListServicesOutput, lastPage bool) bool {
+			for _, s := range out.Services {
+				if *s.Name == name {
+					found = s
+					return false
+				}
+			}
+			return true
+		},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list Cloud Map services: %w", err)
+	}
+	return found, nil
+}
+
+// serviceDiscoveryRoutingPolicy is the routing policy of the Cloud Map service, MULTIVALUE by default
+func serviceDiscoveryRoutingPolicy(c *ConfigServiceDiscovery) string {
+	if c.RoutingPolicy == "" {
+		return servicediscovery.RoutingPolicyMultivalue
+	}
+	return c.RoutingPolicy
+}
+
+// immutableDiscoveryChanges lists the settings which Cloud Map can't update on the existing service
+func immutableDiscoveryChanges(curr *servicediscovery.ServiceSummary, c *ConfigServiceDiscovery) []string {
+	changes := []string{}
+	if curr.DnsConfig != nil && !equalString(curr.DnsConfig.RoutingPolicy, serviceDiscoveryRoutingPolicy(c)) {
+		changes = append(changes, "routing_policy")
+	}
+	// the failure threshold is not compared, Cloud Map always returns 1
+	if (curr.HealthCheckCustomConfig == nil) != (c.HealthCheck == nil) {
+		changes = append(changes, "health_check")
+	}
+	return changes
+}
+
+// discoveryService is the Cloud Map service of a service, curr is nil until created
+type discoveryService struct {
+	name        string
+	namespaceID string
+	sdName      string
+	curr        *servicediscovery.ServiceSummary
+}
+
+func (d discoveryService) target(c *ConfigServiceDiscovery) string {
+	return fmt.Sprintf("%s (%s)", d.sdName, c.Namespace)
+}
+
+// resolveServiceDiscovery finds the Cloud Map services of the services without changes,
+// and sets their arns to serviceRegistries of the services. Services to be created get placeholder arns.
+func (a *App) resolveServiceDiscovery(ctx context.Context, opt DeployOption, names []string) ([]discoveryService, error) {
+	resolved := []discoveryService{}
+	msgs := []string{}
+	for _, name := range names {
+		srv := a.def.nameToSrv[name]
+		c := srv.serviceDiscovery
+		if c == nil {
+			continue
+		}
+
+		nsID, err := a.resolveNamespaceID(ctx, c.Namespace)
+		if err != nil {
+			return nil, err
+		}
+		d := discoveryService{name: name, namespaceID: nsID, sdName: a.serviceDiscoveryName(name, c)}
+		d.curr, err = a.findDiscoveryService(ctx, nsID, d.sdName)
+		if err != nil {
+			return nil, err
+		}
+
+		arn := fmt.Sprintf("(known after create: %s)", d.target(c))
+		if d.curr != nil {
+			arn = *d.curr.Arn
+			if changes := immutableDiscoveryChanges(d.curr, c); len(changes) > 0 {
+				if opt.DryRun {
+					color.Red("! immutable fields changed: service discovery=%s fields=%s", d.target(c), strings.Join(changes, ","))
+				}
+				msgs = append(msgs, fmt.Sprintf("%s (%s)", d.target(c), strings.Join(changes, ", ")))
+			}
+		}
+		srv.srv.ServiceRegistries = []*ecs.ServiceRegistry{serviceRegistry(arn, c)}
+		a.def.nameToSrv[name] = srv
+		resolved = append(resolved, d)
+	}
+
+	if len(msgs) > 0 {
+		err := fmt.Errorf("Cloud Map can't update these settings of an existing service: %s. Delete the Cloud Map service to change them", strings.Join(msgs, ", "))
+		if opt.DryRun {
+			a.Log(err)
+			return resolved, nil
+		}
+		return nil, err
+	}
+	return resolved, nil
+}
+
+// applyServiceDiscovery creates the resolved Cloud Map services if not exist and updates their dns records,
+// and sets the created arns to serviceRegistries of the services.
+func (a *App) applyServiceDiscovery(ctx context.Context, opt DeployOption, resolved []discoveryService) error {
+	for _, d := range resolved {
+		srv := a.def.nameToSrv[d.name]
+		c := srv.serviceDiscovery
+		target := d.target(c)
+
+		if d.curr == nil {
+			in := serviceDiscoveryCreateInput(d.sdName, d.namespaceID, c)
+			if opt.DryRun {
+				color.Green("+ service discovery: %s", target)
+				PrintJSON(in)
+				continue
+			}
+			in.Tags = serviceDiscoveryTags(opt.serviceTags)
+			out, err := a.serviceDiscovery.CreateServiceWithContext(ctx, in)
+			if err != nil {
+				return fmt.Errorf("failed to create Cloud Map service %s: %w", target, err)
+			}
+			a.Log(LogDone(), "Created service discovery", LogTarget(target))
+			srv.srv.ServiceRegistries = []*ecs.ServiceRegistry{serviceRegistry(*out.Service.Arn, c)}
+			a.def.nameToSrv[d.name] = srv
+			continue
+		}
+
+		records := serviceDiscoveryDNSRecords(c)
+		if d.curr.DnsConfig == nil || equalDNSRecords(d.curr.DnsConfig.DnsRecords, records) {
+			continue
+		}
+		if opt.DryRun {
+			color.Green("~ service discovery dns records: %s", target)
+			continue
+		}
+		if _, err := a.serviceDiscovery.UpdateServiceWithContext(ctx, &servicediscovery.UpdateServiceInput{
+			Id: d.curr.Id,
+			Service: &servicediscovery.ServiceChange{
+				DnsConfig: &servicediscovery.DnsConfigChange{DnsRecords: records},
+			},
+		}); err != nil {
+			return fmt.Errorf("failed to update Cloud Map service %s: %w", target, err)
+		}
+		a.Log(LogDone(), "Updated service discovery dns records", LogTarget(target))
+	}
+	return nil
+}
+
+func serviceDiscoveryTags(tags []*ecs.Tag) []*servicediscovery.Tag {
+	dst := []*servicediscovery.Tag{}
+	for _, t := range tags {
+		dst = append(dst, &servicediscovery.Tag{Key: t.Key, Value: t.Value})
+	}
+	return dst
+}
+
+// discoveryServicesOf finds the existing Cloud Map services of the services created by the overlay
+func (a *App) discoveryServicesOf(ctx context.Context, names []string) ([]*servicediscovery.ServiceSummary, error) {
+	services := []*servicediscovery.ServiceSummary{}
+	for _, name := range names {
+		c := a.def.nameToSrv[name].serviceDiscovery
+		if c == nil {
+			continue
+		}
+		nsID, err := a.resolveNamespaceID(ctx, c.Namespace)
+		if err != nil {
+			return nil, err
+		}
+		s, err := a.findDiscoveryService(ctx, nsID, a.serviceDiscoveryName(name, c))
+		if err != nil {
+			return nil, err
+		}
+		if s == nil {
+			continue
+		}
+		tags, err := a.discoveryServiceTags(ctx, *s.Arn)
+		if err != nil {
+			return nil, err
+		}
+		if !a.isManaged(tags) {
+			a.Log(color.YellowString("Skip service discovery not created by ecsceed:"), LogTarget(*s.Name))
+			continue
+		}
+		services = append(services, s)
+	}
+	return services, nil
+}
+
+// discoveryServiceTags returns the tags of the Cloud Map service in the form of ecs tags
+func (a *App) discoveryServiceTags(ctx context.Context, arn string) ([]*ecs.Tag, error) {
+	out, err := a.serviceDiscovery.ListTagsForResourceWithContext(ctx, &servicediscovery.ListTagsForResourceInput{
+		ResourceARN: aws.String(arn),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tags of Cloud Map service %s: %w", arn, err)
+	}
+	tags := []*ecs.Tag{}
+	for _, t := range out.Tags {
+		tags = append(tags, &ecs.Tag{Key: t.Key, Value: t.Value})
+	}
+	return tags, nil
+}
+
+// waitDiscoveryInstancesDeregistered waits until no instance is registered to the Cloud Map service
+func (a *App) waitDiscoveryInstancesDeregistered(ctx context.Context, id string) error {
+	for {
+		out, err := a.serviceDiscovery.ListInstancesWithContext(ctx, &servicediscovery.ListInstancesInput{
+			ServiceId:  aws.String(id),
+			MaxResults: aws.Int64(1),
+		})
+		if err != nil {
+			return err
+		}
+		if len(out.Instances) == 0 {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(serviceDiscoveryPollInterval):
+		}
+	}
+}
+
+func (a *App) DeleteDiscoveryService(ctx context.Context, id string) error {
+	_, err := a.serviceDiscovery.DeleteServiceWithContext(ctx, &servicediscovery.DeleteServiceInput{
+		Id: aws.String(id),
+	})
+	return err
+}
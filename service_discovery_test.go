@@ -0,0 +1,97 @@
+package ecsceed
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/aws/aws-sdk-go/service/servicediscovery"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateServiceDiscovery(t *testing.T) {
+	assert.NoError(t, validateServiceDiscovery(Service{}))
+	assert.NoError(t, validateServiceDiscovery(Service{serviceDiscovery: &ConfigServiceDiscovery{Namespace: "dev.local"}}))
+	assert.NoError(t, validateServiceDiscovery(Service{serviceDiscovery: &ConfigServiceDiscovery{
+		Namespace: "dev.local", HealthCheck: &ConfigServiceDiscoveryHealthCheck{FailureThreshold: 1},
+	}}))
+	assert.NoError(t, validateServiceDiscovery(Service{serviceDiscovery: &ConfigServiceDiscovery{
+		Namespace: "dev.local", RecordType: "srv", ContainerName: "app", ContainerPort: aws.Int64(80),
+	}}))
+
+	invalids := []Service{
+		{serviceDiscovery: &ConfigServiceDiscovery{}},
+		{serviceDiscovery: &ConfigServiceDiscovery{Namespace: "dev.local", RecordType: "CNAME"}},
+		{serviceDiscovery: &ConfigServiceDiscovery{Namespace: "dev.local", RecordType: "SRV"}},
+		{serviceDiscovery: &ConfigServiceDiscovery{Namespace: "dev.local", HealthCheck: &ConfigServiceDiscoveryHealthCheck{FailureThreshold: 3}}},
+		{
+			srv:              ecs.Service{ServiceRegistries: []*ecs.ServiceRegistry{{RegistryArn: aws.String("arn")}}},
+			serviceDiscovery: &ConfigServiceDiscovery{Namespace: "dev.local"},
+		},
+	}
+	for _, srv := range invalids {
+		assert.Error(t, validateServiceDiscovery(srv))
+	}
+}
+
+func TestServiceDiscoveryCreateInput(t *testing.T) {
+	app := &App{def: Definition{namePrefix: "dev-"}}
+	c := &ConfigServiceDiscovery{Namespace: "dev.local"}
+	in := serviceDiscoveryCreateInput(app.serviceDiscoveryName("api", c), "ns-1", c)
+	assert.Equal(t, "dev-api", *in.Name)
+	assert.Equal(t, "ns-1", *in.NamespaceId)
+	assert.Equal(t, servicediscovery.RoutingPolicyMultivalue, *in.DnsConfig.RoutingPolicy)
+	assert.Equal(t, "A", *in.DnsConfig.DnsRecords[0].Type)
+	assert.Equal(t, int64(defaultServiceDiscoveryTTL), *in.DnsConfig.DnsRecords[0].TTL)
+	assert.Nil(t, in.HealthCheckCustomConfig)
+
+	c = &ConfigServiceDiscovery{
+		Namespace:   "dev.local",
+		Name:        "backend",
+		TTL:         aws.Int64(10),
+		HealthCheck: &ConfigServiceDiscoveryHealthCheck{},
+	}
+	in = serviceDiscoveryCreateInput(app.serviceDiscoveryName("api", c), "ns-1", c)
+	assert.Equal(t, "backend", *in.Name)
+	assert.Equal(t, int64(10), *in.DnsConfig.DnsRecords[0].TTL)
+	assert.Equal(t, int64(1), *in.HealthCheckCustomConfig.FailureThreshold)
+}
+
+func TestServiceRegistry(t *testing.T) {
+	r := serviceRegistry("arn:sd", &ConfigServiceDiscovery{ContainerName: "app", ContainerPort: aws.Int64(80)})
+	assert.Equal(t, "arn:sd", *r.RegistryArn)
+	assert.Nil(t, r.ContainerName)
+
+	r = serviceRegistry("arn:sd", &ConfigServiceDiscovery{RecordType: "SRV", ContainerName: "app", ContainerPort: aws.Int64(80)})
+	assert.Equal(t, "app", *r.ContainerName)
+	assert.Equal(t, int64(80), *r.ContainerPort)
+}
+
+func TestEqualDNSRecords(t *testing.T) {
+	records := serviceDiscoveryDNSRecords(&ConfigServiceDiscovery{})
+	assert.True(t, equalDNSRecords(records, []*servicediscovery.DnsRecord{{Type: aws.String("A"), TTL: aws.Int64(60)}}))
+	assert.False(t, equalDNSRecords(records, []*servicediscovery.DnsRecord{{Type: aws.String("A"), TTL: aws.Int64(10)}}))
+	assert.False(t, equalDNSRecords(records, []*servicediscovery.DnsRecord{{Type: aws.String("SRV"), TTL: aws.Int64(60)}}))
+	assert.False(t, equalDNSRecords(records, nil))
+}
+
+func TestImmutableDiscoveryChanges(t *testing.T) {
+	curr := &servicediscovery.ServiceSummary{
+		DnsConfig: &servicediscovery.DnsConfig{RoutingPolicy: aws.String(servicediscovery.RoutingPolicyMultivalue)},
+	}
+	assert.Equal(t, []string{}, immutableDiscoveryChanges(curr, &ConfigServiceDiscovery{Namespace: "dev.local"}))
+	assert.Equal(t, []string{"routing_policy", "health_check"}, immutableDiscoveryChanges(curr, &ConfigServiceDiscovery{
+		Namespace: "dev.local", RoutingPolicy: "WEIGHTED", HealthCheck: &ConfigServiceDiscoveryHealthCheck{FailureThreshold: 1},
+	}))
+
+	curr.HealthCheckCustomConfig = &servicediscovery.HealthCheckCustomConfig{FailureThreshold: aws.Int64(1)}
+	assert.Equal(t, []string{}, immutableDiscoveryChanges(curr, &ConfigServiceDiscovery{
+		Namespace: "dev.local", HealthCheck: &ConfigServiceDiscoveryHealthCheck{FailureThreshold: 1},
+	}))
+	assert.Equal(t, []string{"health_check"}, immutableDiscoveryChanges(curr, &ConfigServiceDiscovery{Namespace: "dev.local"}))
+
+	// Cloud Map returns 1 whatever the threshold is
+	assert.Equal(t, []string{}, immutableDiscoveryChanges(curr, &ConfigServiceDiscovery{
+		Namespace: "dev.local", HealthCheck: &ConfigServiceDiscoveryHealthCheck{FailureThreshold: 3},
+	}))
+}
@@ -113,7 +113,7 @@ func (a *App) servicesStatus(ctx context.Context, names []*string, events int) (
 
 	for i, s := range desc.Services {
 		fmt.Println("Service:", LogTarget(*s.ServiceName))
-		fmt.Println("TaskDefinition:", LogTarget(arnToName(*s.TaskDefinition)))
+		fmt.Println("TaskDefinition:", LogTarget(arnToName(aws.StringValue(s.TaskDefinition))))
 		if len(s.Deployments) > 0 {
 			fmt.Println("Deployments:")
 			for _, dep := range s.Deployments {
@@ -178,7 +178,9 @@ func (a *App) clusterStatus(ctx context.Context) error {
 }
 
 type StatusOption struct {
-	Events int
+	Events          int
+	Services        []string
+	ExcludeServices []string
 }
 
 func (a *App) Status(ctx context.Context, opt StatusOption) error {
@@ -187,10 +189,11 @@ func (a *App) Status(ctx context.Context, opt StatusOption) error {
 		return err
 	}
 
-	srvNames := []*string{}
-	for name := range a.def.nameToSrv {
-		srvNames = append(srvNames, aws.String(a.resolveFullName(name)))
+	names, err := a.selectServices(opt.Services, opt.ExcludeServices)
+	if err != nil {
+		return err
 	}
+	srvNames := a.serviceFullNames(names)
 
 	printSection := color.New(color.FgGreen, color.Bold)
 	printSection.Println(">> Services")
@@ -0,0 +1,146 @@
+package ecsceed
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+)
+
+const (
+	defaultVerifyStatus   = http.StatusOK
+	defaultVerifyRetries  = 3
+	defaultVerifyInterval = 5 * time.Second
+	defaultVerifyTimeout  = 10 * time.Second
+	maxVerifyBodySize     = 1 << 20
+)
+
+type verifyCheck struct {
+	url      string
+	status   int
+	body     *regexp.Regexp
+	retries  int
+	interval time.Duration
+	timeout  time.Duration
+}
+
+func verifyChecks(cs []ConfigVerify) ([]verifyCheck, error) {
+	checks := []verifyCheck{}
+	for _, c := range cs {
+		if c.URL == "" {
+			return nil, fmt.Errorf("verify url is required")
+		}
+		check := verifyCheck{
+			url:      c.URL,
+			status:   defaultVerifyStatus,
+			retries:  defaultVerifyRetries,
+			interval: defaultVerifyInterval,
+			timeout:  defaultVerifyTimeout,
+		}
+		if c.Status > 0 {
+			check.status = c.Status
+		}
+		if c.Retries != nil {
+			check.retries = *c.Retries
+		}
+		if c.Body != "" {
+			re, err := regexp.Compile(c.Body)
+			if err != nil {
+				return nil, fmt.Errorf("invalid verify body %s: %w", c.Body, err)
+			}
+			check.body = re
+		}
+		if c.Interval != "" {
+			d, err := time.ParseDuration(c.Interval)
+			if err != nil {
+				return nil, fmt.Errorf("invalid verify interval %s: %w", c.Interval, err)
+			}
+			check.interval = d
+		}
+		if c.Timeout != "" {
+			d, err := time.ParseDuration(c.Timeout)
+			if err != nil {
+				return nil, fmt.Errorf("invalid verify timeout %s: %w", c.Timeout, err)
+			}
+			check.timeout = d
+		}
+		checks = append(checks, check)
+	}
+	return checks, nil
+}
+
+func (c verifyCheck) try(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	req, err := http.NewRequest(http.MethodGet, c.url, nil)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != c.status {
+		return fmt.Errorf("status %d, expected %d", res.StatusCode, c.status)
+	}
+	if c.body != nil {
+		b, err := ioutil.ReadAll(io.LimitReader(res.Body, maxVerifyBodySize))
+		if err != nil {
+			return err
+		}
+		if !c.body.Match(b) {
+			return fmt.Errorf("body does not match %s", c.body)
+		}
+	}
+	return nil
+}
+
+// run tries the check until it passes up to the retries
+func (c verifyCheck) run(ctx context.Context) (int, error) {
+	var err error
+	for attempt := 1; ; attempt++ {
+		if err = c.try(ctx); err == nil {
+			return attempt, nil
+		}
+		if attempt > c.retries {
+			return attempt, err
+		}
+		select {
+		case <-ctx.Done():
+			return attempt, ctx.Err()
+		case <-time.After(c.interval):
+		}
+	}
+}
+
+// verifyServices runs the HTTP checks of the services and prints the results
+func (a *App) verifyServices(ctx context.Context, names []string) error {
+	failures := []string{}
+	for _, name := range names {
+		checks := a.def.nameToSrv[name].verify
+		for _, c := range checks {
+			attempts, err := c.run(ctx)
+			if err != nil {
+				a.Log(color.RedString("\u2717"), "Verify", LogTarget(name), c.url, fmt.Sprintf("failed after %d attempts: %s", attempts, err))
+				failures = append(failures, fmt.Sprintf("%s %s: %s", name, c.url, err))
+				continue
+			}
+			a.Log(LogDone(), "Verify", LogTarget(name), c.url, fmt.Sprintf("passed (attempts: %d)", attempts))
+		}
+	}
+	if len(failures) > 0 {
+		return fmt.Errorf("verify failed: %s", strings.Join(failures, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package ecsceed
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVerifyChecks(t *testing.T) {
+	retries := 0
+	checks, err := verifyChecks([]ConfigVerify{
+		{URL: "http://localhost/health"},
+		{URL: "http://localhost/", Status: 204, Body: "^ok$", Retries: &retries, Interval: "1s", Timeout: "2s"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, checks[0].status)
+	assert.Equal(t, defaultVerifyRetries, checks[0].retries)
+	assert.Equal(t, 204, checks[1].status)
+	assert.Equal(t, 0, checks[1].retries)
+	assert.Equal(t, time.Second, checks[1].interval)
+	assert.Equal(t, 2*time.Second, checks[1].timeout)
+
+	_, err = verifyChecks([]ConfigVerify{{URL: "http://localhost/", Body: "("}})
+	assert.Error(t, err)
+	_, err = verifyChecks([]ConfigVerify{{}})
+	assert.Error(t, err)
+}
+
+func TestVerifyCheckRun(t *testing.T) {
+	requests := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"status":"ok"}`))
+	}))
+	defer ts.Close()
+
+	checks, err := verifyChecks([]ConfigVerify{{URL: ts.URL, Body: `"status":"ok"`, Interval: "10ms"}})
+	assert.NoError(t, err)
+
+	attempts, err := checks[0].run(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 3, attempts)
+
+	retries := 1
+	checks, err = verifyChecks([]ConfigVerify{{URL: ts.URL, Body: `"status":"ng"`, Retries: &retries, Interval: "10ms"}})
+	assert.NoError(t, err)
+
+	attempts, err = checks[0].run(context.Background())
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "body does not match")
+	}
+	assert.Equal(t, 2, attempts)
+}
+
+func TestVerifyServices(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/health" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	retries := 0
+	ok, _ := verifyChecks([]ConfigVerify{{URL: ts.URL + "/health"}})
+	ng, _ := verifyChecks([]ConfigVerify{{URL: ts.URL + "/missing", Retries: &retries}})
+	app := &App{
+		def: Definition{
+			nameToSrv: map[string]Service{
+				"api":    {verify: ok},
+				"worker": {},
+				"admin":  {verify: ng},
+			},
+		},
+	}
+
+	assert.NoError(t, app.verifyServices(context.Background(), []string{"api", "worker"}))
+	err := app.verifyServices(context.Background(), []string{"api", "admin"})
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "admin")
+		assert.Contains(t, err.Error(), "status 404, expected 200")
+	}
+}
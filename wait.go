@@ -0,0 +1,215 @@
+package ecsceed
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/morikuni/aec"
+	"github.com/pkg/errors"
+)
+
+type WaitOption struct {
+	Timeout          time.Duration
+	FailureThreshold int
+}
+
+var waitServiceInterval = 15 * time.Second
+var defaultFailureThreshold = 3
+
+// stopped reasons which never recover by retrying
+var fatalStoppedReasons = []string{
+	"CannotPullContainerError",
+	"CannotCreateContainerError",
+	"CannotStartContainerError",
+	"ResourceInitializationError",
+}
+
+// service event messages which never recover by retrying
+var fatalEventMessages = []string{
+	"unable to place a task",
+}
+
+func isServiceStable(s *ecs.Service) bool {
+	return len(s.Deployments) == 1 && *s.RunningCount == *s.DesiredCount
+}
+
+func formatStoppedTask(t *ecs.Task) string {
+	msg := fmt.Sprintf("task %s stopped: %s", arnToName(*t.TaskArn), aws.StringValue(t.StoppedReason))
+	for _, c := range t.Containers {
+		if c.ExitCode != nil {
+			msg += fmt.Sprintf(", container %s exit code %d", *c.Name, *c.ExitCode)
+		}
+		if c.Reason != nil {
+			msg += fmt.Sprintf(", container %s reason %s", *c.Name, *c.Reason)
+		}
+	}
+	return msg
+}
+
+func containsAny(s string, subs []string) bool {
+	for _, sub := range subs {
+		if strings.Contains(s, sub) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkStoppedTasks fails when a task stopped by an unrecoverable reason,
+// or stopped tasks reach the threshold (e.g. crash loop, health check failures)
+func checkStoppedTasks(tasks []*ecs.Task, threshold int) error {
+	failed := []string{}
+	for _, t := range tasks {
+		if equalString(t.StopCode, ecs.TaskStopCodeUserInitiated) {
+			continue
+		}
+		msg := formatStoppedTask(t)
+		if containsAny(aws.StringValue(t.StoppedReason), fatalStoppedReasons) {
+			return errors.New(msg)
+		}
+		for _, c := range t.Containers {
+			if containsAny(aws.StringValue(c.Reason), fatalStoppedReasons) {
+				return errors.New(msg)
+			}
+		}
+		failed = append(failed, msg)
+	}
+	if len(failed) >= threshold {
+		return fmt.Errorf("%d tasks stopped: %s", len(failed), strings.Join(failed, "; "))
+	}
+	return nil
+}
+
+func checkServiceEvents(s *ecs.Service, startedAt time.Time) error {
+	for _, e := range s.Events {
+		if !e.CreatedAt.After(startedAt) {
+			continue
+		}
+		if containsAny(*e.Message, fatalEventMessages) {
+			return errors.New(*e.Message)
+		}
+	}
+	return nil
+}
+
+func primaryTaskDefinition(s *ecs.Service) string {
+	for _, d := range s.Deployments {
+		if *d.Status == "PRIMARY" {
+			return *d.TaskDefinition
+		}
+	}
+	return aws.StringValue(s.TaskDefinition)
+}
+
+func (a *App) checkServicesStable(ctx context.Context, startedAt time.Time, names []*string, threshold int) (bool, error) {
+	out, err := a.DescribeServices(ctx, names)
+	if err != nil {
+		return false, err
+	}
+	for _, f := range out.Failures {
+		return false, fmt.Errorf("service %s is %s", arnToName(*f.Arn), *f.Reason)
+	}
+
+	stable := true
+	for _, s := range out.Services {
+		if *s.Status != "ACTIVE" {
+			return false, fmt.Errorf("service %s is %s", *s.ServiceName, *s.Status)
+		}
+		if isServiceStable(s) {
+			continue
+		}
+		stable = false
+
+		if err := checkServiceEvents(s, startedAt); err != nil {
+			return false, fmt.Errorf("service %s failed: %w", *s.ServiceName, err)
+		}
+
+		tasks, err := a.ListStoppedServiceTasks(ctx, *s.ServiceName, primaryTaskDefinition(s), startedAt)
+		if err != nil {
+			return false, err
+		}
+		if err := checkStoppedTasks(tasks, threshold); err != nil {
+			return false, fmt.Errorf("service %s failed: %w", *s.ServiceName, err)
+		}
+	}
+	return stable, nil
+}
+
+func (a *App) WaitServiceStable(ctx context.Context, startedAt time.Time, names []*string, opt WaitOption) error {
+	if len(names) == 0 {
+		return nil
+	}
+	a.Log("Waiting for service stable...(it will take a few minutes)")
+	waitStartedAt := time.Now()
+	if opt.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opt.Timeout)
+		defer cancel()
+	}
+	threshold := opt.FailureThreshold
+	if threshold <= 0 {
+		threshold = defaultFailureThreshold
+	}
+
+	waitCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// progress is not displayed when the output is shared with parallel updates
+	showProgress := a.logPrefix == ""
+
+	go func() {
+		if !showProgress {
+			return
+		}
+		tick := time.Tick(10 * time.Second)
+		var lines int
+		for {
+			select {
+			case <-waitCtx.Done():
+				return
+			case <-tick:
+				if isTerminal {
+					for i := 0; i < lines; i++ {
+						fmt.Print(aec.EraseLine(aec.EraseModes.All), aec.PreviousLine(1))
+					}
+				}
+				lines, _ = a.DescribeServiceDeployments(waitCtx, startedAt, names)
+			}
+		}
+	}()
+
+	for {
+		stable, err := a.checkServicesStable(ctx, startedAt, names, threshold)
+		if err != nil {
+			if ctx.Err() != nil {
+				return waitContextError(ctx.Err(), opt.Timeout, waitStartedAt)
+			}
+			return err
+		}
+		if stable {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return waitContextError(ctx.Err(), opt.Timeout, waitStartedAt)
+		case <-time.After(waitServiceInterval):
+		}
+	}
+}
+
+// waitContextError tells a timeout from a cancellation of waiting for service stable.
+// The deadline may be of the caller without timeout, then the elapsed time is reported.
+func waitContextError(err error, timeout time.Duration, startedAt time.Time) error {
+	if err == context.DeadlineExceeded {
+		if timeout <= 0 {
+			timeout = time.Since(startedAt).Round(time.Second)
+		}
+		return fmt.Errorf("timed out after %s waiting for service stable: %w", timeout, err)
+	}
+	return fmt.Errorf("canceled waiting for service stable: %w", err)
+}
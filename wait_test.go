@@ -0,0 +1,54 @@
+package ecsceed
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckStoppedTasks(t *testing.T) {
+	crashed := &ecs.Task{
+		TaskArn:       aws.String("arn:aws:ecs:ap-northeast-1:123456789012:task/my-cluster/abc"),
+		StoppedReason: aws.String("Essential container in task exited"),
+		Containers: []*ecs.Container{
+			{Name: aws.String("app"), ExitCode: aws.Int64(1)},
+		},
+	}
+	assert.NoError(t, checkStoppedTasks([]*ecs.Task{crashed}, 3))
+
+	err := checkStoppedTasks([]*ecs.Task{crashed, crashed, crashed}, 3)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "container app exit code 1")
+	}
+
+	pullFailed := &ecs.Task{
+		TaskArn:       aws.String("arn:aws:ecs:ap-northeast-1:123456789012:task/my-cluster/def"),
+		StoppedReason: aws.String("CannotPullContainerError: pull image manifest has been retried 1 time(s)"),
+	}
+	assert.Error(t, checkStoppedTasks([]*ecs.Task{pullFailed}, 3))
+
+	scaledIn := &ecs.Task{
+		TaskArn:       aws.String("arn:aws:ecs:ap-northeast-1:123456789012:task/my-cluster/ghi"),
+		StopCode:      aws.String(ecs.TaskStopCodeUserInitiated),
+		StoppedReason: aws.String("Scaling activity initiated by deployment"),
+	}
+	assert.NoError(t, checkStoppedTasks([]*ecs.Task{scaledIn, scaledIn, scaledIn}, 3))
+}
+
+func TestWaitContextError(t *testing.T) {
+	err := waitContextError(context.DeadlineExceeded, 10*time.Minute, time.Now())
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+	assert.Contains(t, err.Error(), "timed out after 10m0s")
+
+	err = waitContextError(context.DeadlineExceeded, 0, time.Now().Add(-5*time.Minute))
+	assert.Contains(t, err.Error(), "timed out after 5m0s")
+
+	err = waitContextError(context.Canceled, 10*time.Minute, time.Now())
+	assert.True(t, errors.Is(err, context.Canceled))
+	assert.NotContains(t, err.Error(), "timed out")
+}